@@ -14,17 +14,21 @@ const API_BASE = isLocalhost
     ? 'http://127.0.0.1:7860' 
     : 'https://manhteky123-dapp-meeting.hf.space';
 
-let APP_ID;
-let APP_TOKEN;
-
 let localStream;
 let localPeerConnection;
 let participants = new Map(); // Store participant connections
 let ws; // WebSocket connection
+// Highest WebSocket protocol version this client speaks
+const WS_PROTOCOL_VERSION = 1;
+// Resume state from the server's hello, lets a reconnect pick up missed events
+let wsResumeToken = null;
+let wsLastSeq = 0;
 
 const urlParams = new URLSearchParams(window.location.search);
 const roomId = urlParams.get('roomId');
 const username = urlParams.get('username');
+// Signed join token issued by the backend when joining the meeting
+let joinToken = sessionStorage.getItem('joinToken');
 
 // Get stored device preferences
 const devicePrefs = JSON.parse(localStorage.getItem('selectedDevices') || '{}');
@@ -45,14 +49,6 @@ let blurCanvas = null;
 async function initializeRoom() {
     try {
         await loadAvailableMasks();
-        // Fetch Cloudflare credentials first
-        const credentialsResponse = await fetch(`${API_BASE}/cloudflare/credentials`);
-        if (!credentialsResponse.ok) {
-            throw new Error('Failed to fetch Cloudflare credentials');
-        }
-        const credentials = await credentialsResponse.json();
-        APP_ID = credentials.appId;
-        APP_TOKEN = credentials.token;
 
         // Initialize local media with stored preferences
         localStream = await navigator.mediaDevices.getUserMedia({
@@ -89,7 +85,9 @@ async function initializeRoom() {
         updateControls();
 
         // Get session info from backend
-        const response = await fetch(`${API_BASE}/meetings/${roomId}/info`);
+        const response = await fetch(`${API_BASE}/meetings/${roomId}/info`, {
+            headers: { 'Authorization': `Bearer ${joinToken}` }
+        });
         if (!response.ok) {
             throw new Error('Failed to fetch meeting info');
         }
@@ -147,12 +145,8 @@ async function handleExistingParticipants(sessions) {
         try {
             // Get session state from Cloudflare
             const sessionState = await fetch(
-                `https://rtc.live.cloudflare.com/v1/apps/${APP_ID}/sessions/${participant.session_id}`,
-                {
-                    headers: {
-                        "Authorization": `Bearer ${APP_TOKEN}`
-                    }
-                }
+                `${API_BASE}/meetings/${roomId}/sessions/${participant.session_id}`,
+                { headers: { 'Authorization': `Bearer ${joinToken}` } }
             ).then(res => res.json());
 
             console.log('Session state for existing participant:', participant.username, sessionState);
@@ -274,12 +268,12 @@ async function pullParticipantTracks(tracks, participant) {
             // Pull remote tracks
             console.log(`Pulling tracks for participant ${participant.username} using local session ${localSessionId}`);
             const pullResponse = await fetch(
-                `https://rtc.live.cloudflare.com/v1/apps/${APP_ID}/sessions/${localSessionId}/tracks/new`,
+                `${API_BASE}/meetings/${roomId}/sessions/${localSessionId}/tracks/new`,
                 {
                     method: "POST",
                     headers: {
-                        "Authorization": `Bearer ${APP_TOKEN}`,
-                        "Content-Type": "application/json"
+                        "Content-Type": "application/json",
+                        "Authorization": `Bearer ${joinToken}`
                     },
                     body: JSON.stringify({
                         tracks: tracks.map(track => ({
@@ -354,7 +348,10 @@ async function setupWebSocket() {
         const wsBaseUrl = isLocalhost
             ? 'localhost:7860'
             : 'manhteky123-dapp-meeting.hf.space';
-        const wsUrl = `${wsProtocol}//${wsBaseUrl}/ws/meetings/${roomId}?username=${encodeURIComponent(username)}`;
+        let wsUrl = `${wsProtocol}//${wsBaseUrl}/ws/meetings/${roomId}?token=${encodeURIComponent(joinToken)}&protocol_version=${WS_PROTOCOL_VERSION}`;
+        if (wsResumeToken) {
+            wsUrl += `&resume_token=${encodeURIComponent(wsResumeToken)}&last_seq=${wsLastSeq}`;
+        }
         
         console.log('Connecting to WebSocket:', wsUrl);
         
@@ -390,16 +387,18 @@ async function setupWebSocket() {
                     timestamp: new Date().toISOString()
                 });
 
-                // Only attempt to reconnect on abnormal closure
-                if (event.code === 1006) {
-                    console.log('Abnormal closure detected, attempting to reconnect...');
+                // Only attempt to reconnect on abnormal closure or a server restart
+                if (event.code === 1006 || event.code === 1012) {
+                    console.log('Connection lost, attempting to reconnect...');
+                    const delay = shutdownRetryAfterMs || 3000;
+                    shutdownRetryAfterMs = null;
                     setTimeout(() => {
                         if (!ws || ws.readyState === WebSocket.CLOSED) {
                             setupWebSocket().catch(err => {
                                 console.error('Reconnection failed:', err);
                             });
                         }
-                    }, 3000);
+                    }, delay);
                 }
             };
 
@@ -411,6 +410,9 @@ async function setupWebSocket() {
                         ws.send('pong');
                         return;
                     }
+                    if (data.seq) {
+                        wsLastSeq = data.seq;
+                    }
                     handleWebSocketMessage(data);
                 } catch (e) {
                     console.warn('Error handling WebSocket message:', e);
@@ -448,6 +450,9 @@ function handleWebSocketMessage(message) {
         case 'room_state':
             console.log('Room state update received:', message.payload);
             updateParticipants(message.payload);
+            if (message.payload.chat_history) {
+                renderChatHistory(message.payload.chat_history);
+            }
             break;
         case 'participant_left':
             console.log('Participant left:', message.payload);
@@ -471,31 +476,157 @@ function handleWebSocketMessage(message) {
             handleSpeakingState(message.payload);
             break;
         case 'chat_message':
+        case 'direct_message':
             handleChatMessage(message.payload);
             break;
+        case 'chat_edited':
+        case 'chat_deleted':
+        case 'chat_reacted':
+            updateChatMessage(message.payload);
+            break;
+        case 'participant_muted':
+            handleParticipantMuted(message.payload);
+            break;
+        case 'participant_removed':
+            handleParticipantRemoved(message.payload);
+            break;
+        case 'meeting_ended':
+            handleMeetingEnded(message.payload);
+            break;
+        case 'server_shutdown':
+            handleServerShutdown(message.payload);
+            break;
+        case 'lobby_request':
+            handleLobbyRequest(message.payload);
+            break;
+        case 'hello':
+            console.log('WebSocket protocol version:', message.payload.protocol_version);
+            wsResumeToken = message.payload.resume_token;
+            if (message.payload.resume_rejected) {
+                console.warn('Could not resume the connection:', message.payload.resume_rejected);
+            }
+            // Without a replay room_state follows, count from the current sequence
+            if (!message.payload.replayed) {
+                wsLastSeq = message.payload.seq;
+            }
+            break;
+        case 'error':
+            console.warn(`Server error (${message.payload.code}):`, message.payload.message, message.payload);
+            break;
     }
 }
 
+// Someone is waiting in the lobby, only hosts receive this
+function handleLobbyRequest(data) {
+    const admit = confirm(`${data.username} wants to join the meeting. Admit?`);
+    safeSendWebSocketMessage({
+        type: admit ? 'admit_participant' : 'deny_participant',
+        payload: { request_id: data.request_id }
+    }).catch(err => console.error('Failed to answer lobby request:', err));
+}
+
+// The host muted us, turn off the microphone locally
+function handleParticipantMuted(data) {
+    if (!localPeerConnection || data.session_id !== localPeerConnection.sessionId) return;
+    localStream.getAudioTracks().forEach(track => track.enabled = false);
+    updateControls();
+    alert(`You were muted by ${data.by}`);
+}
+
+// The host removed us from the meeting
+function handleParticipantRemoved(data) {
+    if (!localPeerConnection || data.session_id !== localPeerConnection.sessionId) return;
+    alert(`You were removed from the meeting by ${data.by}`);
+    window.location.href = 'index.html';
+}
+
+// The host ended the meeting for everyone
+function handleMeetingEnded(data) {
+    alert(`The meeting was ended by ${data.by}`);
+    window.location.href = 'index.html';
+}
+
+// The server is restarting, the close handler reconnects after its hint
+let shutdownRetryAfterMs = null;
+function handleServerShutdown(data) {
+    shutdownRetryAfterMs = data.retry_after_ms;
+}
+
+// Replace the chat with the history sent by the server on connect
+function renderChatHistory(history) {
+    const messages = document.getElementById('chatMessages');
+    messages.innerHTML = '';
+    history.forEach(appendChatMessage);
+}
+
 // Add chat message handler
 function handleChatMessage(data) {
+    appendChatMessage(data);
+
+    // Show notification if chat is minimized
+    if (!document.getElementById('chatContainer').classList.contains('show')) {
+        showNotification('chat', data);
+    }
+}
+
+function appendChatMessage(data) {
     const messages = document.getElementById('chatMessages');
     const messageDiv = document.createElement('div');
-    messageDiv.className = `chat-message ${data.username === username ? 'own-message' : ''}`;
+    messageDiv.dataset.messageId = data.id;
+    renderChatMessage(messageDiv, data);
+    
+    messages.appendChild(messageDiv);
+    messages.scrollTop = messages.scrollHeight;
+}
+
+// Edits, deletes and reactions re-render the message in place
+function updateChatMessage(data) {
+    const messageDiv = document.querySelector(`#chatMessages [data-message-id="${data.id}"]`);
+    if (messageDiv) {
+        renderChatMessage(messageDiv, data);
+    }
+}
+
+function renderChatMessage(messageDiv, data) {
+    messageDiv.className = `chat-message ${data.username === username ? 'own-message' : ''} ${data.recipient ? 'direct-message' : ''} ${data.deleted_at ? 'deleted-message' : ''}`;
+    // Direct messages show who they were sent to
+    const recipient = data.recipient ? ` → ${escapeHtml(data.recipient.username)} (private)` : '';
+    const edited = data.edited_at && !data.deleted_at ? ' <span class="message-edited">(edited)</span>' : '';
+    const reply = data.reply_to ? replyPreview(data.reply_to) : '';
+    const content = data.deleted_at ? '<em>This message was deleted</em>' : escapeHtml(data.content);
+    const reactions = (data.reactions || []).map(reaction =>
+        `<button class="message-reaction" data-emoji="${escapeHtml(reaction.emoji)}">${escapeHtml(reaction.emoji)} ${reaction.count}</button>`
+    ).join('');
     
     messageDiv.innerHTML = `
         <div class="message-header">
-            <span class="message-username">${escapeHtml(data.username)}</span>
-            <span class="message-time">${new Date(data.timestamp).toLocaleTimeString()}</span>
+            <span class="message-username">${escapeHtml(data.username)}${recipient}</span>
+            <span class="message-time">${new Date(data.timestamp).toLocaleTimeString()}${edited}</span>
         </div>
-        <div class="message-content">${escapeHtml(data.content)}</div>
+        ${reply}
+        <div class="message-content">${content}</div>
+        <div class="message-reactions">${reactions}</div>
     `;
-    
-    messages.appendChild(messageDiv);
-    messages.scrollTop = messages.scrollHeight;
-    
-    // Show notification if chat is minimized
-    if (!document.getElementById('chatContainer').classList.contains('show')) {
-        showNotification('chat', data);
+
+    // Clicking a reaction toggles our own
+    messageDiv.querySelectorAll('.message-reaction').forEach(button => {
+        button.onclick = () => sendChatReaction(data.id, button.dataset.emoji);
+    });
+}
+
+// Quote the start of the message a reply belongs to, when we still have it
+function replyPreview(parentId) {
+    const parent = document.querySelector(`#chatMessages [data-message-id="${parentId}"] .message-content`);
+    const text = parent ? parent.textContent.slice(0, 80) : 'an earlier message';
+    return `<div class="message-reply">↪ ${escapeHtml(text)}</div>`;
+}
+
+function sendChatReaction(messageId, emoji) {
+    if (ws && ws.readyState === WebSocket.OPEN) {
+        ws.send(JSON.stringify({
+            type: 'chat_react',
+            payload: { message_id: messageId, emoji }
+        }));
     }
 }
 
@@ -564,11 +695,8 @@ async function handleNewParticipant(data) {
 
         // Get session state from Cloudflare
         const sessionState = await fetch(
-            `https://rtc.live.cloudflare.com/v1/apps/${APP_ID}/sessions/${data.session_id}`, {
-            headers: {
-                "Authorization": `Bearer ${APP_TOKEN}`
-            }
-        }).then(res => res.json());
+            `${API_BASE}/meetings/${roomId}/sessions/${data.session_id}`,
+            { headers: { 'Authorization': `Bearer ${joinToken}` } }).then(res => res.json());
 
         console.log('New participant session state:', sessionState);
 
@@ -621,11 +749,8 @@ async function handleTracksReady(data) {
     try {
         const isScreenShare = data.username.endsWith('_screen');
         const sessionState = await fetch(
-            `https://rtc.live.cloudflare.com/v1/apps/${APP_ID}/sessions/${data.session_id}`, {
-            headers: {
-                "Authorization": `Bearer ${APP_TOKEN}`
-            }
-        }).then(res => res.json());
+            `${API_BASE}/meetings/${roomId}/sessions/${data.session_id}`,
+            { headers: { 'Authorization': `Bearer ${joinToken}` } }).then(res => res.json());
 
         if (sessionState.tracks && sessionState.tracks.length > 0) {
             const activeTracks = sessionState.tracks.filter(track => track.status === 'active');
@@ -693,11 +818,11 @@ async function setupCloudflareRTC(sessionId) {
 
             // Send local tracks to server with retry logic
             console.log(`Sending local tracks to server (attempt ${attempt + 1})`);
-            const response = await fetch(`https://rtc.live.cloudflare.com/v1/apps/${APP_ID}/sessions/${sessionId}/tracks/new`, {
+            const response = await fetch(`${API_BASE}/meetings/${roomId}/sessions/${sessionId}/tracks/new`, {
                 method: 'POST',
                 headers: {
-                    'Authorization': `Bearer ${APP_TOKEN}`,
-                    'Content-Type': 'application/json'
+                    'Content-Type': 'application/json',
+                    'Authorization': `Bearer ${joinToken}`
                 },
                 body: JSON.stringify({
                     sessionDescription: { 
@@ -748,7 +873,10 @@ async function setupCloudflareRTC(sessionId) {
             // Notify that our tracks are ready
             const notifyResponse = await fetch(`${API_BASE}/meetings/${roomId}/notify-tracks-ready`, {
                 method: 'POST',
-                headers: { 'Content-Type': 'application/json' },
+                headers: {
+                    'Content-Type': 'application/json',
+                    'Authorization': `Bearer ${joinToken}`
+                },
                 body: JSON.stringify({
                     session_id: sessionId,
                     username: username
@@ -1126,12 +1254,12 @@ async function pullParticipantTracks(tracks, participant) {
             // Pull remote tracks
             console.log('Sending pull tracks request for:', participant.username);
             const pullResponse = await fetch(
-                `https://rtc.live.cloudflare.com/v1/apps/${APP_ID}/sessions/${localSessionId}/tracks/new`,
+                `${API_BASE}/meetings/${roomId}/sessions/${localSessionId}/tracks/new`,
                 {
                     method: "POST",
                     headers: {
-                        "Authorization": `Bearer ${APP_TOKEN}`,
-                        "Content-Type": "application/json"
+                        "Content-Type": "application/json",
+                        "Authorization": `Bearer ${joinToken}`
                     },
                     body: JSON.stringify({
                         tracks: tracks.map(track => ({
@@ -1245,12 +1373,12 @@ async function handleRenegotiation(pullData, peerConnection) {
             await peerConnection.setLocalDescription(answer);
 
             const renegotiateResponse = await fetch(
-                `https://rtc.live.cloudflare.com/v1/apps/${APP_ID}/sessions/${peerConnection.sessionId}/renegotiate`,
+                `${API_BASE}/meetings/${roomId}/sessions/${peerConnection.sessionId}/renegotiate`,
                 {
                     method: "PUT",
                     headers: {
-                        "Authorization": `Bearer ${APP_TOKEN}`,
-                        "Content-Type": "application/json"
+                        "Content-Type": "application/json",
+                        "Authorization": `Bearer ${joinToken}`
                     },
                     body: JSON.stringify({
                         sessionDescription: {
@@ -1476,6 +1604,7 @@ document.getElementById('shareScreenBtn').onclick = async () => {
                 headers: {
                     'Content-Type': 'application/json',
                     'Accept': 'application/json',
+                    'Authorization': `Bearer ${joinToken}`,
                     'Origin': window.location.origin
                 },
                 credentials: 'include'
@@ -1489,9 +1618,10 @@ document.getElementById('shareScreenBtn').onclick = async () => {
         // Get session ID for screen share
         const screenSession = await joinResponse.json();
         const screenSessionId = screenSession.session_id;
+        const screenToken = screenSession.token;
 
         // Create peer connection and setup WebRTC for screen share
-        await setupScreenShare(screenSessionId, screenStream);
+        await setupScreenShare(screenSessionId, screenStream, screenToken);
 
         // Handle stream ending
         screenStream.getVideoTracks()[0].onended = async () => {
@@ -1499,7 +1629,8 @@ document.getElementById('shareScreenBtn').onclick = async () => {
                 await fetch(`${API_BASE}/meetings/${roomId}/leave`, {
                     method: 'POST',
                     headers: {
-                        'Content-Type': 'application/json'
+                        'Content-Type': 'application/json',
+                        'Authorization': `Bearer ${screenToken}`
                     },
                     body: JSON.stringify({
                         session_id: screenSessionId
@@ -1522,7 +1653,7 @@ document.getElementById('shareScreenBtn').onclick = async () => {
     }
 };
 
-async function setupScreenShare(sessionId, screenStream) {
+async function setupScreenShare(sessionId, screenStream, screenToken) {
     // Create new peer connection for screen share
     const screenPeerConnection = new RTCPeerConnection({
         iceServers: [{ urls: 'stun:stun.cloudflare.com:3478' }],
@@ -1544,12 +1675,12 @@ async function setupScreenShare(sessionId, screenStream) {
 
     // Send tracks to Cloudflare
     const cloudflareResponse = await fetch(
-        `https://rtc.live.cloudflare.com/v1/apps/${APP_ID}/sessions/${sessionId}/tracks/new`,
+        `${API_BASE}/meetings/${roomId}/sessions/${sessionId}/tracks/new`,
         {
             method: 'POST',
             headers: {
-                'Authorization': `Bearer ${APP_TOKEN}`,
-                'Content-Type': 'application/json'
+                'Content-Type': 'application/json',
+                'Authorization': `Bearer ${screenToken}`
             },
             body: JSON.stringify({
                 sessionDescription: {
@@ -1586,7 +1717,10 @@ async function setupScreenShare(sessionId, screenStream) {
     // Notify that tracks are ready
     await fetch(`${API_BASE}/meetings/${roomId}/notify-tracks-ready`, {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: {
+            'Content-Type': 'application/json',
+            'Authorization': `Bearer ${screenToken}`
+        },
         body: JSON.stringify({
             session_id: sessionId,
             username: `${username}_screen`
@@ -1748,6 +1882,27 @@ function verifyStreamMappings() {
 // Call this periodically or after significant events
 setInterval(verifyStreamMappings, 10000);
 
+// Join tokens are short-lived, refresh well before they expire so
+// reconnects and leave requests keep working during long meetings
+async function refreshJoinToken() {
+    try {
+        const response = await fetch(`${API_BASE}/meetings/${roomId}/token`, {
+            method: 'POST',
+            headers: { 'Authorization': `Bearer ${joinToken}` }
+        });
+        if (!response.ok) {
+            throw new Error(`Token refresh failed: ${response.status}`);
+        }
+        const data = await response.json();
+        joinToken = data.token;
+        sessionStorage.setItem('joinToken', joinToken);
+    } catch (err) {
+        console.error('Error refreshing join token:', err);
+    }
+}
+
+setInterval(refreshJoinToken, 10 * 60 * 1000);
+
 // Add after localStream initialization in initializeRoom()
 function setupAudioDetection() {
     try {
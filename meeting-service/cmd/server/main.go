@@ -1,34 +1,69 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"meeting-service/internal/auth"
+	"meeting-service/internal/broker"
 	"meeting-service/internal/config"
 	"meeting-service/internal/database"
 	"meeting-service/internal/handlers"
+	"meeting-service/internal/logging"
+	"meeting-service/internal/metrics"
+	"meeting-service/internal/models"
 	"meeting-service/internal/services"
+	"meeting-service/internal/store"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
 func main() {
+	// Load configuration, refuse to start with an invalid one
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	// Cancelled on SIGINT or SIGTERM, background workers stop with it
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger, err := logging.New(os.Stdout, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		slog.Error("Invalid logging configuration", "error", err)
+		os.Exit(1)
+	}
+	// Packages without an injected logger and the standard log package use it too
+	slog.SetDefault(logger)
+
 	// Initialize Echo
 	e := echo.New()
+	e.HideBanner = true
+	e.Server.ReadTimeout = cfg.ReadTimeout
+	e.Server.WriteTimeout = cfg.WriteTimeout
+	e.Server.IdleTimeout = cfg.IdleTimeout
 
-	// Add logging middleware
-	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
-		Format: "method=${method}, uri=${uri}, status=${status}, latency=${latency_human}, body=${body}\n",
-	}))
+	// Request IDs and a structured access log, bodies are only logged in debug mode
+	e.Use(middleware.RequestID())
+	e.Use(logging.Middleware(logger))
+	e.Use(logging.BodyDump(logger))
 
-	// Add request body dumper for debugging
-	e.Use(middleware.BodyDump(func(c echo.Context, reqBody, resBody []byte) {
-		log.Printf("Request Body: %s\n", reqBody)
-		log.Printf("Response Body: %s\n", resBody)
-	}))
+	// Request latency per route for /metrics
+	if cfg.MetricsEnabled {
+		e.Use(metrics.Middleware())
+	}
 
-	// Update CORS configuration to allow all origins
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"}, // Allow all origins
+		AllowOrigins: cfg.CORSAllowedOrigins,
 		AllowMethods: []string{echo.GET, echo.PUT, echo.POST, echo.DELETE, echo.OPTIONS},
 		AllowHeaders: []string{
 			echo.HeaderOrigin,
@@ -41,34 +76,189 @@ func main() {
 		MaxAge:           86400, // Cache preflight requests for 24 hours
 	}))
 
-	// Load configuration
-	cfg := config.LoadConfig()
-
-	// Connect to MongoDB
-	database.Connect(cfg.MongoDBURI)
+	// Initialize meeting store, MongoDB unless the in-memory store is requested
+	var meetingStore store.MeetingStore
+	var chatStore store.ChatStore
+	var webhookStore store.WebhookStore
+	var attendanceStore store.AttendanceStore
+	var speakingStore store.SpeakingStore
+	if cfg.StoreBackend == "memory" {
+		logger.Info("Using in-memory meeting store")
+		meetingStore = store.NewMemoryMeetingStore()
+		chatStore = store.NewMemoryChatStore()
+		webhookStore = store.NewMemoryWebhookStore()
+		attendanceStore = store.NewMemoryAttendanceStore()
+		speakingStore = store.NewMemorySpeakingStore()
+	} else {
+		if err := database.Connect(cfg.MongoDBURI); err != nil {
+			logger.Error("Failed to connect to MongoDB", "error", err)
+			os.Exit(1)
+		}
+		meetingStore, err = store.NewMongoMeetingStore(ctx)
+		if err == nil {
+			chatStore, err = store.NewMongoChatStore(ctx)
+		}
+		if err == nil {
+			webhookStore, err = store.NewMongoWebhookStore(ctx)
+		}
+		if err == nil {
+			attendanceStore, err = store.NewMongoAttendanceStore(ctx)
+		}
+		if err == nil {
+			speakingStore, err = store.NewMongoSpeakingStore(ctx)
+		}
+		if err != nil {
+			logger.Error("Failed to create MongoDB indexes", "error", err)
+			os.Exit(1)
+		}
+	}
 
 	// Initialize services
 	cloudflareService := services.NewCloudflareService(
 		cfg.CloudflareAppID,
 		cfg.CloudflareToken,
 	)
+	cloudflareService.BaseURL = strings.TrimSuffix(cfg.CloudflareAPIURL, "/") + "/" + cfg.CloudflareAppID
+
+	// Global webhooks come from the config, meetings register their own
+	var webhookService *services.WebhookService
+	if cfg.WebhooksEnabled {
+		globalWebhooks := make([]models.Webhook, 0, len(cfg.WebhookURLs))
+		for _, url := range cfg.WebhookURLs {
+			globalWebhooks = append(globalWebhooks, models.Webhook{URL: url, Secret: cfg.WebhookSecret})
+		}
+		webhookService = services.NewWebhookService(webhookStore, globalWebhooks, cfg.WebhookMaxAttempts, logger)
+		go webhookService.Run(ctx)
+	}
+
+	tokenManager := auth.NewTokenManager(cfg.JoinTokenSecret, cfg.JoinTokenTTL)
+
+	// Room broadcasts reach the other instances through the broker
+	var roomBroker broker.Broker = broker.NewLocal()
+	var natsBroker *broker.NATS
+	if cfg.Broker == "nats" {
+		natsBroker, err = broker.NewNATS(cfg.NATSURL, cfg.BrokerSubjectPrefix, logger)
+		if err != nil {
+			logger.Error("Failed to connect to the broker", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Using NATS broker", "subjects", cfg.BrokerSubjectPrefix+".*")
+		roomBroker = natsBroker
+	}
+
+	hub := handlers.NewHub(cfg.WSSendBuffer, cfg.WSReplayBuffer, roomBroker, logger)
+	if err := hub.Start(); err != nil {
+		logger.Error("Failed to subscribe to room broadcasts", "error", err)
+		os.Exit(1)
+	}
+	if cfg.MetricsEnabled {
+		metrics.RegisterRooms(hub.Stats)
+	}
 
 	// Initialize handlers
-	meetingHandler := handlers.NewMeetingHandler(cloudflareService)
+	meetingHandler := handlers.NewMeetingHandler(meetingStore, chatStore, cloudflareService, tokenManager, hub, attendanceStore, speakingStore, webhookService, handlers.Options{
+		JoinWindow:         cfg.ScheduleJoinWindow,
+		FrontendURL:        cfg.FrontendURL,
+		SessionGracePeriod: cfg.SessionGracePeriod,
+		MeetingIdleTTL:     cfg.MeetingIdleTTL,
+		ReaperInterval:     cfg.ReaperInterval,
+		ResumeWindow:       cfg.ResumeWindow,
+		Logger:             logger,
+	})
+	go meetingHandler.RunReaper(ctx)
+
+	// Readiness checks, Cloudflare is only reported since an outage there
+	// would take every instance out of rotation at once
+	healthChecks := []handlers.HealthCheck{
+		{Name: "server", Required: true, Check: meetingHandler.CheckAcceptingJoins},
+	}
+	if cfg.StoreBackend != "memory" {
+		healthChecks = append(healthChecks, handlers.HealthCheck{Name: "mongo", Required: true, Check: database.Ping})
+	}
+	if natsBroker != nil {
+		healthChecks = append(healthChecks, handlers.HealthCheck{Name: "broker", Required: true, Check: natsBroker.Ping})
+	}
+	if cfg.ReadyCheckCloudflare {
+		healthChecks = append(healthChecks, handlers.HealthCheck{Name: "cloudflare", Check: cloudflareService.Ping})
+	}
+	healthHandler := handlers.NewHealthHandler(healthChecks)
 
 	// Set up routes
-	e.POST("/meetings", meetingHandler.CreateMeeting)
-	e.GET("/meetings/:roomID", meetingHandler.JoinMeeting)
+	e.GET("/healthz", healthHandler.Healthz)
+	e.GET("/readyz", healthHandler.Readyz)
+	if cfg.MetricsEnabled {
+		e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+	}
+	e.POST("/meetings", meetingHandler.CreateMeeting, meetingHandler.RejectWhileDraining)
+	e.GET("/meetings/:roomID", meetingHandler.JoinMeeting, meetingHandler.RejectWhileDraining)
 	e.GET("/meetings/:roomID/info", meetingHandler.GetMeetingInfo)
-	e.GET("/cloudflare/credentials", meetingHandler.GetCloudflareCredentials) // Add this line
+	// Schedule routes
+	e.GET("/meetings/:roomId/occurrences", meetingHandler.GetOccurrences)
+	e.GET("/users/:id/meetings/upcoming", meetingHandler.GetUpcomingMeetings, meetingHandler.RequireFeedToken)
+	// Calendar routes
+	e.GET("/meetings/:roomID/invite.ics", meetingHandler.GetMeetingInvite)
+	e.GET("/users/:id/meetings.ics", meetingHandler.GetUserCalendar, meetingHandler.RequireFeedToken)
 	// Add WebSocket route
-	e.GET("/ws/meetings/:roomId", meetingHandler.HandleWebSocket)
+	e.GET("/ws/meetings/:roomId", meetingHandler.HandleWebSocket, meetingHandler.RejectWhileDraining, meetingHandler.RequireJoinToken)
 	// Add new routes
-	e.POST("/meetings/:roomId/notify-tracks-ready", meetingHandler.NotifyTracksReady)
-	e.POST("/meetings/:roomId/leave", meetingHandler.LeaveMeeting)
+	e.POST("/meetings/:roomId/notify-tracks-ready", meetingHandler.NotifyTracksReady, meetingHandler.RequireJoinToken)
+	e.POST("/meetings/:roomId/leave", meetingHandler.LeaveMeeting, meetingHandler.RequireJoinToken)
+	e.POST("/meetings/:roomId/token", meetingHandler.RefreshToken, meetingHandler.RequireJoinToken)
+	// Moderation routes, the join token identifies the acting host or co-host
+	e.POST("/meetings/:roomId/participants/:sessionId/mute", meetingHandler.MuteParticipant, meetingHandler.RequireJoinToken)
+	e.POST("/meetings/:roomId/participants/:sessionId/remove", meetingHandler.RemoveParticipant, meetingHandler.RequireJoinToken)
+	e.POST("/meetings/:roomId/participants/:sessionId/ban", meetingHandler.BanParticipant, meetingHandler.RequireJoinToken)
+	e.POST("/meetings/:roomId/participants/:sessionId/promote", meetingHandler.PromoteParticipant, meetingHandler.RequireJoinToken)
+	e.GET("/meetings/:roomId/chat", meetingHandler.GetChatHistory, meetingHandler.RequireJoinToken)
+	e.POST("/meetings/:roomId/lock", meetingHandler.LockMeeting, meetingHandler.RequireJoinToken)
+	e.POST("/meetings/:roomId/unlock", meetingHandler.UnlockMeeting, meetingHandler.RequireJoinToken)
+	e.POST("/meetings/:roomId/end", meetingHandler.EndMeeting, meetingHandler.RequireJoinToken)
+	e.GET("/meetings/:roomId/attendance", meetingHandler.GetAttendance, meetingHandler.RequireModeratorToken)
+	e.GET("/meetings/:roomId/speaking-stats", meetingHandler.GetSpeakingStats, meetingHandler.RequireModeratorToken)
+	// Webhook routes, host only
+	if cfg.WebhooksEnabled {
+		e.POST("/meetings/:roomId/webhooks", meetingHandler.CreateWebhook, meetingHandler.RequireJoinToken)
+		e.GET("/meetings/:roomId/webhooks", meetingHandler.ListWebhooks, meetingHandler.RequireJoinToken)
+		e.DELETE("/meetings/:roomId/webhooks/:webhookId", meetingHandler.DeleteWebhook, meetingHandler.RequireJoinToken)
+	}
+	// Lobby routes, waiting users poll with the secret returned by the join endpoint
+	e.GET("/meetings/:roomId/lobby/:requestId", meetingHandler.GetLobbyStatus)
+	e.POST("/meetings/:roomId/lobby/:requestId/admit", meetingHandler.AdmitLobbyRequest, meetingHandler.RequireJoinToken)
+	e.POST("/meetings/:roomId/lobby/:requestId/deny", meetingHandler.DenyLobbyRequest, meetingHandler.RequireJoinToken)
+	// Cloudflare Calls proxy routes, the app token never leaves the backend
+	e.GET("/meetings/:roomId/sessions/:sessionId", meetingHandler.GetSessionState, meetingHandler.RequireJoinToken)
+	e.POST("/meetings/:roomId/sessions/:sessionId/tracks/new", meetingHandler.AddTracks, meetingHandler.RequireJoinToken)
+	e.PUT("/meetings/:roomId/sessions/:sessionId/renegotiate", meetingHandler.Renegotiate, meetingHandler.RequireJoinToken)
+	e.PUT("/meetings/:roomId/sessions/:sessionId/tracks/close", meetingHandler.CloseTracks, meetingHandler.RequireJoinToken)
 	// Add new route
 	e.GET("/masks", meetingHandler.GetAvailableMasks)
 
 	// Start server
-	log.Fatal(e.Start(":7860"))
+	go func() {
+		if err := e.Start(fmt.Sprintf(":%d", cfg.Port)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Server stopped", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	logger.Info("Shutting down", "timeout", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Sockets first so clients hear about the shutdown while joins are refused,
+	// then the remaining HTTP handlers
+	if err := meetingHandler.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("Error draining rooms", "error", err)
+	}
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("Error stopping HTTP server", "error", err)
+	}
+	if err := roomBroker.Close(); err != nil {
+		logger.Warn("Error closing the broker", "error", err)
+	}
+	if err := database.Disconnect(shutdownCtx); err != nil {
+		logger.Warn("Error disconnecting from MongoDB", "error", err)
+	}
+	logger.Info("Shutdown complete")
 }
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidToken = errors.New("invalid join token")
+
+// JoinClaims binds a join token to a single participant session in a room
+type JoinClaims struct {
+	RoomID        string `json:"room_id"`
+	SessionID     string `json:"session_id"`
+	ParticipantID string `json:"participant_id"`
+	Username      string `json:"username"`
+	jwt.RegisteredClaims
+}
+
+// TokenManager issues and verifies HMAC-SHA256 signed join tokens
+type TokenManager struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewTokenManager(secret string, ttl time.Duration) *TokenManager {
+	return &TokenManager{
+		secret: []byte(secret),
+		ttl:    ttl,
+	}
+}
+
+func (m *TokenManager) Issue(roomID, sessionID, participantID, username string) (string, error) {
+	now := time.Now()
+	claims := JoinClaims{
+		RoomID:        roomID,
+		SessionID:     sessionID,
+		ParticipantID: participantID,
+		Username:      username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   participantID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(m.ttl)),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign join token: %v", err)
+	}
+	return token, nil
+}
+
+// Verify checks the signature and expiry and that the token was issued for roomID
+func (m *TokenManager) Verify(tokenString string, roomID string) (*JoinClaims, error) {
+	var claims JoinClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		return m.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if claims.RoomID != roomID || claims.SessionID == "" {
+		return nil, ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// FeedToken is the unguessable token that lets a user read the feeds of the
+// meetings they created. It does not expire so calendar subscriptions keep
+// working, rotating the secret revokes every feed token.
+func (m *TokenManager) FeedToken(userID string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte("feed:" + userID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyFeedToken reports whether token is the feed token of userID
+func (m *TokenManager) VerifyFeedToken(token, userID string) bool {
+	return token != "" && hmac.Equal([]byte(token), []byte(m.FeedToken(userID)))
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestVerify(t *testing.T) {
+	tokens := NewTokenManager(testSecret, time.Hour)
+	valid, err := tokens.Issue("room", "session", "participant", "alice")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	expired, err := NewTokenManager(testSecret, -time.Minute).Issue("room", "session", "participant", "alice")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	otherSecret, err := NewTokenManager("another-secret-another-secret-xx", time.Hour).Issue("room", "session", "participant", "alice")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	// Tokens with valid claims that the manager did not sign the expected way
+	claims := JoinClaims{
+		RoomID:        "room",
+		SessionID:     "session",
+		ParticipantID: "participant",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	hs512, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("signing HS512: %v", err)
+	}
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("signing none: %v", err)
+	}
+	withoutExpiry := claims
+	withoutExpiry.ExpiresAt = nil
+	noExpiry, err := jwt.NewWithClaims(jwt.SigningMethodHS256, withoutExpiry).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatalf("signing without expiry: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		roomID  string
+		wantErr bool
+	}{
+		{"round trip", valid, "room", false},
+		{"other room", valid, "other-room", true},
+		{"expired", expired, "room", true},
+		{"wrong secret", otherSecret, "room", true},
+		{"wrong signing method", hs512, "room", true},
+		{"unsigned", unsigned, "room", true},
+		{"no expiry", noExpiry, "room", true},
+		{"garbage", "not-a-token", "room", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tokens.Verify(tt.token, tt.roomID)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("Verify() error = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if got.RoomID != "room" || got.SessionID != "session" || got.ParticipantID != "participant" || got.Username != "alice" {
+				t.Errorf("Verify() claims = %+v", got)
+			}
+		})
+	}
+}
+
+func TestFeedToken(t *testing.T) {
+	tokens := NewTokenManager(testSecret, time.Hour)
+	token := tokens.FeedToken("user")
+
+	if !tokens.VerifyFeedToken(token, "user") {
+		t.Error("VerifyFeedToken() rejected the user's own token")
+	}
+	if tokens.VerifyFeedToken(token, "other-user") {
+		t.Error("VerifyFeedToken() accepted the token for another user")
+	}
+	if tokens.VerifyFeedToken("", "user") {
+		t.Error("VerifyFeedToken() accepted an empty token")
+	}
+	if NewTokenManager("another-secret-another-secret-xx", time.Hour).VerifyFeedToken(token, "user") {
+		t.Error("VerifyFeedToken() accepted a token signed with another secret")
+	}
+}
@@ -0,0 +1,54 @@
+package broker
+
+import (
+	"context"
+	"sync"
+)
+
+// Broker carries room messages between the instances of the service. Every
+// instance subscribes to all rooms and delivers to its own connections.
+type Broker interface {
+	// Publish sends the message to every subscriber, this instance included
+	Publish(ctx context.Context, roomId string, data []byte) error
+	// Subscribe calls handle for the messages of every room until Close
+	Subscribe(handle func(roomId string, data []byte)) error
+	Close() error
+}
+
+// Local is the in-process broker for a single instance, Publish calls the
+// subscribers before it returns
+type Local struct {
+	mu       sync.RWMutex
+	handlers []func(roomId string, data []byte)
+}
+
+func NewLocal() *Local {
+	return &Local{}
+}
+
+func (b *Local) Publish(ctx context.Context, roomId string, data []byte) error {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, handle := range handlers {
+		handle(roomId, data)
+	}
+	return nil
+}
+
+func (b *Local) Subscribe(handle func(roomId string, data []byte)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, handle)
+	return nil
+}
+
+func (b *Local) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = nil
+	return nil
+}
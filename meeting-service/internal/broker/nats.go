@@ -0,0 +1,79 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATS fans room messages out through a NATS server, one subject per room
+// below the prefix
+type NATS struct {
+	conn   *nats.Conn
+	prefix string
+	logger *slog.Logger
+	sub    *nats.Subscription
+}
+
+// NewNATS connects to the server at url and keeps reconnecting for as long
+// as the service runs
+func NewNATS(url, prefix string, logger *slog.Logger) (*NATS, error) {
+	b := &NATS{prefix: strings.TrimSuffix(prefix, "."), logger: logger}
+
+	conn, err := nats.Connect(url,
+		nats.Name("meeting-service"),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(time.Second),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				logger.Warn("Disconnected from NATS", "error", err)
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			logger.Info("Reconnected to NATS", "url", conn.ConnectedUrlRedacted())
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			logger.Error("NATS error", "error", err)
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %v", err)
+	}
+	b.conn = conn
+	return b, nil
+}
+
+func (b *NATS) subject(roomId string) string {
+	return b.prefix + "." + roomId
+}
+
+func (b *NATS) Publish(ctx context.Context, roomId string, data []byte) error {
+	return b.conn.Publish(b.subject(roomId), data)
+}
+
+func (b *NATS) Subscribe(handle func(roomId string, data []byte)) error {
+	sub, err := b.conn.Subscribe(b.prefix+".*", func(msg *nats.Msg) {
+		handle(strings.TrimPrefix(msg.Subject, b.prefix+"."), msg.Data)
+	})
+	if err != nil {
+		return err
+	}
+	// Room traffic is bursty, don't let a slow moment drop messages
+	sub.SetPendingLimits(-1, 64<<20)
+	b.sub = sub
+	return nil
+}
+
+// Ping round-trips to the server, used by the readiness check
+func (b *NATS) Ping(ctx context.Context) error {
+	return b.conn.FlushWithContext(ctx)
+}
+
+// Close delivers what was already received and disconnects
+func (b *NATS) Close() error {
+	return b.conn.Drain()
+}
@@ -0,0 +1,310 @@
+// Package calendar renders meetings as iCalendar (RFC 5545) documents
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"meeting-service/internal/models"
+)
+
+const (
+	prodID = "-//Dapp Meeting//Meeting Service//EN"
+	// Unscheduled meetings are shown as an hour long event from their creation
+	defaultEventDuration = time.Hour
+	// Content lines longer than this many octets are folded
+	maxLineOctets = 75
+	// Stands in for the host in UIDs when the deployment has no frontend URL
+	defaultHost = "meeting-service.invalid"
+
+	localTimeFormat = "20060102T150405"
+	utcTimeFormat   = "20060102T150405Z"
+)
+
+// Event is a meeting with the details that are not stored on it
+type Event struct {
+	Meeting *models.Meeting
+	// JoinURL is where attendees open the meeting, the event has no link
+	// when it is empty
+	JoinURL string
+	// Host is used to build a globally unique UID, defaultHost when empty
+	Host string
+	// Public invites name the organizer without the creator's email or ID
+	Public bool
+}
+
+// Render writes a VCALENDAR containing one VEVENT per event
+func Render(events []Event, now time.Time) []byte {
+	w := &writer{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:" + prodID)
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+
+	// Every TZID used by an event needs a matching VTIMEZONE
+	zones := map[string]*time.Location{}
+	for _, event := range events {
+		if schedule := event.Meeting.Schedule; schedule != nil {
+			if loc := schedule.Location(); loc != time.UTC {
+				zones[loc.String()] = loc
+			}
+		}
+	}
+	names := make([]string, 0, len(zones))
+	for name := range zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w.timezone(zones[name], now)
+	}
+
+	for _, event := range events {
+		w.event(event, now)
+	}
+
+	w.line("END:VCALENDAR")
+	return []byte(w.b.String())
+}
+
+type writer struct {
+	b strings.Builder
+}
+
+// line writes a content line, folded to 75 octets and terminated by CRLF.
+// Control characters are dropped so no value can start a property of its own.
+func (w *writer) line(s string) {
+	s = stripControls(s)
+	limit := maxLineOctets
+	for len(s) > limit {
+		// Never split a multi-byte character
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.b.WriteString(s[:cut])
+		w.b.WriteString("\r\n ")
+		s = s[cut:]
+		// The leading space of a continuation line counts towards its length
+		limit = maxLineOctets - 1
+	}
+	w.b.WriteString(s)
+	w.b.WriteString("\r\n")
+}
+
+func (w *writer) event(event Event, now time.Time) {
+	meeting := event.Meeting
+	if event.Host == "" {
+		event.Host = defaultHost
+	}
+
+	w.line("BEGIN:VEVENT")
+	w.line(fmt.Sprintf("UID:%s@%s", meeting.RoomID, event.Host))
+	w.line("DTSTAMP:" + now.UTC().Format(utcTimeFormat))
+	w.line("CREATED:" + meeting.CreatedAt.UTC().Format(utcTimeFormat))
+	w.line("LAST-MODIFIED:" + meeting.UpdatedAt.UTC().Format(utcTimeFormat))
+
+	if schedule := meeting.Schedule; schedule != nil {
+		// DTSTART always counts as an occurrence, so use the first one the
+		// rule produces in case the scheduled start does not match it
+		start, end := schedule.StartTime, schedule.EndTime
+		if first := schedule.Occurrences(time.Time{}, 1); len(first) > 0 {
+			start, end = first[0].StartTime, first[0].EndTime
+		}
+		w.line(dateTime("DTSTART", start, schedule.Location()))
+		w.line(dateTime("DTEND", end, schedule.Location()))
+		if rrule := schedule.RRule(); rrule != "" {
+			w.line("RRULE:" + rrule)
+		}
+	} else {
+		w.line(dateTime("DTSTART", meeting.CreatedAt, time.UTC))
+		w.line(dateTime("DTEND", meeting.CreatedAt.Add(defaultEventDuration), time.UTC))
+	}
+
+	w.line("SUMMARY:" + escapeText(meeting.Title))
+	description := meeting.Description
+	if event.JoinURL != "" {
+		if description != "" {
+			description += "\n\n"
+		}
+		description += "Join the meeting: " + event.JoinURL
+	}
+	if description != "" {
+		w.line("DESCRIPTION:" + escapeText(description))
+	}
+	if event.JoinURL != "" {
+		w.line("LOCATION:" + escapeText(event.JoinURL))
+		w.line("URL:" + event.JoinURL)
+	}
+	w.line(organizer(event))
+	if cancelled(meeting) {
+		w.line("STATUS:CANCELLED")
+	} else {
+		w.line("STATUS:CONFIRMED")
+	}
+	w.line("TRANSP:OPAQUE")
+	w.line("END:VEVENT")
+}
+
+// cancelled reports whether the meeting was ended with no occurrence left to
+// start after it, calendars then stop showing it as upcoming
+func cancelled(meeting *models.Meeting) bool {
+	if meeting.EndedAt == nil {
+		return false
+	}
+	if meeting.Schedule == nil {
+		return true
+	}
+	for _, occurrence := range meeting.Schedule.Occurrences(*meeting.EndedAt, 2) {
+		if occurrence.StartTime.After(*meeting.EndedAt) {
+			return false
+		}
+	}
+	return true
+}
+
+// organizer uses the creator's email when it is known, otherwise a URN built
+// from the creator ID so the property still names a calendar user. Public
+// invites only carry the name, their URN is built from the room instead.
+func organizer(event Event) string {
+	meeting := event.Meeting
+	property := "ORGANIZER"
+	if meeting.CreatorName != "" {
+		property += ";CN=" + quoteParam(meeting.CreatorName)
+	}
+	if event.Public {
+		return fmt.Sprintf("%s:urn:x-meeting-room:%s@%s", property, meeting.RoomID, event.Host)
+	}
+	if meeting.CreatorEmail != "" {
+		return property + ":mailto:" + meeting.CreatorEmail
+	}
+	return fmt.Sprintf("%s:urn:x-meeting-user:%s@%s", property, meeting.CreatorID.Hex(), event.Host)
+}
+
+func dateTime(name string, t time.Time, loc *time.Location) string {
+	if loc == time.UTC {
+		return name + ":" + t.UTC().Format(utcTimeFormat)
+	}
+	return fmt.Sprintf("%s;TZID=%s:%s", name, loc.String(), t.In(loc).Format(localTimeFormat))
+}
+
+// timezone writes a VTIMEZONE for loc. Go exposes offsets but not the zone
+// rules, so the transitions of the current year are turned into yearly rules.
+func (w *writer) timezone(loc *time.Location, now time.Time) {
+	w.line("BEGIN:VTIMEZONE")
+	w.line("TZID:" + loc.String())
+
+	transitions := yearTransitions(loc, now.In(loc).Year())
+	if len(transitions) == 0 {
+		name, offset := now.In(loc).Zone()
+		w.line("BEGIN:STANDARD")
+		w.line("DTSTART:19700101T000000")
+		w.line("TZOFFSETFROM:" + formatOffset(offset))
+		w.line("TZOFFSETTO:" + formatOffset(offset))
+		w.line("TZNAME:" + name)
+		w.line("END:STANDARD")
+	}
+
+	for _, at := range transitions {
+		before := at.Add(-time.Second)
+		_, offsetFrom := before.Zone()
+		name, offsetTo := at.Zone()
+
+		component := "STANDARD"
+		if at.IsDST() {
+			component = "DAYLIGHT"
+		}
+		// DTSTART is the wall clock time the transition happens at, in the
+		// offset that was in effect before it
+		local := at.UTC().Add(time.Duration(offsetFrom) * time.Second)
+
+		w.line("BEGIN:" + component)
+		w.line("DTSTART:" + local.Format(localTimeFormat))
+		w.line(fmt.Sprintf("RRULE:FREQ=YEARLY;BYMONTH=%d;BYDAY=%s", local.Month(), weekdayOfMonth(local)))
+		w.line("TZOFFSETFROM:" + formatOffset(offsetFrom))
+		w.line("TZOFFSETTO:" + formatOffset(offsetTo))
+		w.line("TZNAME:" + name)
+		w.line("END:" + component)
+	}
+
+	w.line("END:VTIMEZONE")
+}
+
+// yearTransitions returns the instants in year at which loc changes its offset
+func yearTransitions(loc *time.Location, year int) []time.Time {
+	var transitions []time.Time
+	end := time.Date(year+1, 1, 1, 0, 0, 0, 0, loc)
+	for t := time.Date(year, 1, 1, 0, 0, 0, 0, loc); t.Before(end); t = t.Add(24 * time.Hour) {
+		next := t.Add(24 * time.Hour)
+		_, from := t.Zone()
+		_, to := next.Zone()
+		if from == to {
+			continue
+		}
+		// Narrow the day down to the exact second of the change
+		lo, hi := t, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, offset := mid.Zone(); offset == from {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		transitions = append(transitions, hi)
+	}
+	return transitions
+}
+
+// weekdayOfMonth renders the BYDAY of t, e.g. 2SU or -1SU for the last Sunday
+func weekdayOfMonth(t time.Time) string {
+	day := [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}[t.Weekday()]
+	daysInMonth := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if t.Day()+7 > daysInMonth {
+		return "-1" + day
+	}
+	return fmt.Sprintf("%d%s", (t.Day()-1)/7+1, day)
+}
+
+func formatOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign = '-'
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// escapeText escapes a TEXT value as described in RFC 5545 section 3.3.11
+func escapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\r", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// quoteParam quotes a parameter value, neither DQUOTE nor control characters
+// are allowed in it
+func quoteParam(s string) string {
+	return `"` + strings.ReplaceAll(stripControls(s), `"`, "'") + `"`
+}
+
+// stripControls drops the control characters RFC 5545 forbids in values,
+// only HTAB is allowed
+func stripControls(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,62 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"meeting-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRenderStatus(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	ended := now.Add(-time.Hour)
+	daily := &models.Schedule{
+		StartTime:  now.Add(-25 * time.Hour),
+		EndTime:    now.Add(-24 * time.Hour),
+		Timezone:   "UTC",
+		Recurrence: "FREQ=DAILY",
+	}
+	lastOccurrence := *daily
+	lastOccurrence.Recurrence = "FREQ=DAILY;COUNT=2"
+
+	tests := []struct {
+		name     string
+		endedAt  *time.Time
+		schedule *models.Schedule
+		want     string
+	}{
+		{"not ended", nil, nil, "STATUS:CONFIRMED"},
+		{"ended unscheduled", &ended, nil, "STATUS:CANCELLED"},
+		{"ended with occurrences to come", &ended, daily, "STATUS:CONFIRMED"},
+		{"ended after the last occurrence", &ended, &lastOccurrence, "STATUS:CANCELLED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meeting := models.NewMeeting("Standup", "", primitive.NewObjectID(), "room")
+			meeting.EndedAt = tt.endedAt
+			meeting.Schedule = tt.schedule
+
+			ics := string(Render([]Event{{Meeting: meeting}}, now))
+			if !strings.Contains(ics, tt.want+"\r\n") {
+				t.Errorf("Render() has no %s:\n%s", tt.want, ics)
+			}
+		})
+	}
+}
+
+func TestRenderWithoutJoinURL(t *testing.T) {
+	meeting := models.NewMeeting("Standup", "", primitive.NewObjectID(), "room")
+
+	ics := string(Render([]Event{{Meeting: meeting}}, time.Now()))
+	for _, property := range []string{"URL:", "LOCATION:", "DESCRIPTION:"} {
+		if strings.Contains(ics, "\r\n"+property) {
+			t.Errorf("Render() without a join URL has %s:\n%s", property, ics)
+		}
+	}
+	if !strings.Contains(ics, "UID:room@"+defaultHost+"\r\n") {
+		t.Errorf("Render() without a host has no UID at %s:\n%s", defaultHost, ics)
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// setRequired sets the variables a memory-backed instance needs
+func setRequired(t *testing.T) {
+	t.Helper()
+	t.Setenv("MEETING_STORE", "memory")
+	t.Setenv("CLOUDFLARE_APP_ID", "app")
+	t.Setenv("CLOUDFLARE_TOKEN", "token")
+}
+
+func TestWebhookURLsRequireSecret(t *testing.T) {
+	setRequired(t)
+	t.Setenv("WEBHOOK_URLS", "https://hooks.example.com/meetings")
+
+	_, err := LoadConfig()
+	if err == nil || !strings.Contains(err.Error(), "WEBHOOK_SECRET is required") {
+		t.Fatalf("LoadConfig() error = %v, want WEBHOOK_SECRET is required", err)
+	}
+
+	t.Setenv("WEBHOOK_SECRET", "webhook-secret")
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() with WEBHOOK_SECRET: %v", err)
+	}
+	if len(cfg.WebhookURLs) != 1 || cfg.WebhookSecret != "webhook-secret" {
+		t.Errorf("webhooks = %v signed with %q", cfg.WebhookURLs, cfg.WebhookSecret)
+	}
+}
+
+func TestWebhookSecretOptionalWithoutURLs(t *testing.T) {
+	setRequired(t)
+
+	if _, err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig() without WEBHOOK_URLS: %v", err)
+	}
+}
+
+func TestMongoStoreRequiresJoinTokenSecret(t *testing.T) {
+	setRequired(t)
+	t.Setenv("MEETING_STORE", "mongo")
+	t.Setenv("MONGODB_URI", "mongodb://localhost:27017")
+
+	_, err := LoadConfig()
+	if err == nil || !strings.Contains(err.Error(), "JOIN_TOKEN_SECRET is required") {
+		t.Fatalf("LoadConfig() error = %v, want JOIN_TOKEN_SECRET is required", err)
+	}
+
+	secret := strings.Repeat("s", 32)
+	t.Setenv("JOIN_TOKEN_SECRET", secret)
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() with JOIN_TOKEN_SECRET: %v", err)
+	}
+	if cfg.JoinTokenSecret != secret {
+		t.Errorf("JoinTokenSecret = %q, want the configured one", cfg.JoinTokenSecret)
+	}
+}
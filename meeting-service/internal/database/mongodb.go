@@ -2,20 +2,25 @@ package database
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"time"
 
+	"meeting-service/internal/metrics"
+
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 var client *mongo.Client
 
-func Connect(uri string) {
+func Connect(uri string) error {
 	var err error
-	client, err = mongo.NewClient(options.Client().ApplyURI(uri))
+	client, err = mongo.NewClient(options.Client().ApplyURI(uri).SetMonitor(commandMonitor()))
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -23,15 +28,44 @@ func Connect(uri string) {
 
 	err = client.Connect(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	err = client.Ping(ctx, nil)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	slog.Info("Connected to MongoDB")
+	return nil
+}
+
+// commandMonitor records the latency of every command sent to MongoDB
+func commandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			metrics.ObserveMongo(e.CommandName, e.Duration, false)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			metrics.ObserveMongo(e.CommandName, e.Duration, true)
+		},
 	}
+}
 
-	log.Println("Connected to MongoDB!")
+// Ping checks that the primary is reachable
+func Ping(ctx context.Context) error {
+	if client == nil {
+		return errors.New("not connected")
+	}
+	return client.Ping(ctx, readpref.Primary())
+}
+
+// Disconnect closes the client's connections, a no-op when never connected
+func Disconnect(ctx context.Context) error {
+	if client == nil {
+		return nil
+	}
+	return client.Disconnect(ctx)
 }
 
 func GetCollection(collectionName string) *mongo.Collection {
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"meeting-service/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// recordAttendance stores an attendance event, failures only cost accuracy
+// of the report so they are logged and otherwise ignored
+func (h *MeetingHandler) recordAttendance(roomId string, session *models.Session, eventType string) {
+	event := models.NewAttendanceEvent(roomId, session, eventType)
+	if err := h.attendance.RecordAttendance(context.Background(), event); err != nil {
+		h.roomLogger(roomId).Error("Error recording attendance",
+			"session_id", session.SessionID,
+			"type", eventType,
+			"error", err,
+		)
+	}
+}
+
+// GetAttendance reports each participant's attendance as JSON, or as CSV with
+// ?format=csv. Only the host and co-hosts may read it, RequireModeratorToken
+// checks that without a live session so it keeps working after the meeting ended.
+func (h *MeetingHandler) GetAttendance(c echo.Context) error {
+	roomId := c.Param("roomId")
+
+	events, err := h.attendance.ListAttendance(context.Background(), roomId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load attendance"})
+	}
+	records := models.BuildAttendanceReport(events, time.Now())
+
+	if c.QueryParam("format") == "csv" || strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/csv") {
+		return attendanceCSV(c, roomId, records)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"room_id":      roomId,
+		"participants": records,
+	})
+}
+
+func attendanceCSV(c echo.Context, roomId string, records []models.AttendanceRecord) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"participant_id", "username", "first_join", "last_leave", "connected_seconds", "reconnects"})
+	for _, record := range records {
+		lastLeave := ""
+		if record.LastLeave != nil {
+			lastLeave = record.LastLeave.UTC().Format(time.RFC3339)
+		}
+		w.Write([]string{
+			record.ParticipantID.Hex(),
+			record.Username,
+			record.FirstJoin.UTC().Format(time.RFC3339),
+			lastLeave,
+			strconv.FormatInt(record.ConnectedSeconds, 10),
+			strconv.Itoa(record.Reconnects),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="attendance-`+roomId+`.csv"`)
+	return c.Blob(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
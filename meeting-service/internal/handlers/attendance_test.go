@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"meeting-service/internal/broker"
+	"meeting-service/internal/models"
+)
+
+// authorized sends a request with the participant's join token
+func authorized(t *testing.T, method, url string, p *testParticipant) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatalf("building request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	return resp
+}
+
+func TestAttendanceAfterMeetingEnded(t *testing.T) {
+	cluster := newTestCluster(t, broker.NewLocal())
+	instance := cluster.instances[0]
+
+	roomId, alice := cluster.createMeeting(t, instance)
+	bob := cluster.join(t, instance, roomId, "bob")
+
+	resp := authorized(t, http.MethodPost, instance.url+"/meetings/"+roomId+"/end", alice)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ending meeting: status %d", resp.StatusCode)
+	}
+
+	resp = authorized(t, http.MethodGet, instance.url+"/meetings/"+roomId+"/attendance", alice)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("attendance: status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	var report struct {
+		Participants []models.AttendanceRecord `json:"participants"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("decoding attendance: %v", err)
+	}
+	if len(report.Participants) != 2 {
+		t.Errorf("attendance lists %d participants, want 2", len(report.Participants))
+	}
+
+	// Participants other than the host and co-hosts stay locked out
+	resp = authorized(t, http.MethodGet, instance.url+"/meetings/"+roomId+"/attendance", bob)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("attendance for bob: status %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+}
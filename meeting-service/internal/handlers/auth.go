@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"meeting-service/internal/auth"
+	"meeting-service/internal/logging"
+	"meeting-service/internal/models"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const joinClaimsKey = "joinClaims"
+
+// joinTokenFromRequest reads the token from the Authorization header, falling
+// back to the token query parameter since browsers cannot set headers on
+// WebSocket upgrades
+func joinTokenFromRequest(c echo.Context) string {
+	header := c.Request().Header.Get(echo.HeaderAuthorization)
+	if strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	return c.QueryParam("token")
+}
+
+// RequireJoinToken rejects requests without a valid join token for the room in
+// the path, or whose session is no longer part of the meeting, e.g. after it
+// was removed or banned. It exposes the verified claims through joinClaims.
+func (h *MeetingHandler) RequireJoinToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := joinTokenFromRequest(c)
+		if token == "" {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Join token is required"})
+		}
+
+		claims, err := h.tokens.Verify(token, c.Param("roomId"))
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or expired join token"})
+		}
+
+		meeting, err := h.store.GetMeetingByRoom(c.Request().Context(), claims.RoomID)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Meeting not found"})
+		}
+		if meeting.FindSession(claims.SessionID) == nil || tokenRevoked(meeting, claims) {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Session is no longer part of the meeting"})
+		}
+
+		c.Set(joinClaimsKey, claims)
+		logging.With(c, "session_id", claims.SessionID, "username", claims.Username)
+		return next(c)
+	}
+}
+
+// RequireModeratorToken admits the host and co-hosts by the participant ID of
+// their join token. Unlike RequireJoinToken it does not need a live session,
+// so reports stay readable after the meeting ended and cleared its sessions.
+func (h *MeetingHandler) RequireModeratorToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := joinTokenFromRequest(c)
+		if token == "" {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Join token is required"})
+		}
+
+		claims, err := h.tokens.Verify(token, c.Param("roomId"))
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or expired join token"})
+		}
+
+		meeting, err := h.store.GetMeetingByRoom(c.Request().Context(), claims.RoomID)
+		if err != nil {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Meeting not found"})
+		}
+		if tokenRevoked(meeting, claims) {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Session is no longer part of the meeting"})
+		}
+		participantID, _ := primitive.ObjectIDFromHex(claims.ParticipantID)
+		if !meeting.IsModerator(participantID) {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": errNotModerator.Error()})
+		}
+
+		c.Set(joinClaimsKey, claims)
+		logging.With(c, "session_id", claims.SessionID, "username", claims.Username)
+		return next(c)
+	}
+}
+
+// RequireFeedToken rejects requests for a user's feeds without that user's
+// feed token, calendar apps pass it as the token query parameter
+func (h *MeetingHandler) RequireFeedToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !h.tokens.VerifyFeedToken(joinTokenFromRequest(c), c.Param("id")) {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or missing feed token"})
+		}
+		return next(c)
+	}
+}
+
+// participantFromToken returns the caller's session when the request carries a
+// valid join token for a session that is still part of the meeting
+func (h *MeetingHandler) participantFromToken(c echo.Context, meeting *models.Meeting) *models.Session {
+	token := joinTokenFromRequest(c)
+	if token == "" {
+		return nil
+	}
+	claims, err := h.tokens.Verify(token, meeting.RoomID)
+	if err != nil || tokenRevoked(meeting, claims) {
+		return nil
+	}
+	return meeting.FindSession(claims.SessionID)
+}
+
+// tokenRevoked reports whether the token's participant was removed from the
+// meeting, none of their tokens count any more
+func tokenRevoked(meeting *models.Meeting, claims *auth.JoinClaims) bool {
+	participantID, err := primitive.ObjectIDFromHex(claims.ParticipantID)
+	return err != nil || meeting.IsRevoked(participantID)
+}
+
+func joinClaims(c echo.Context) *auth.JoinClaims {
+	claims, _ := c.Get(joinClaimsKey).(*auth.JoinClaims)
+	return claims
+}
+
+// RefreshToken issues a fresh join token while the session is still part of the meeting
+func (h *MeetingHandler) RefreshToken(c echo.Context) error {
+	claims := joinClaims(c)
+
+	meeting, err := h.store.GetMeetingByRoom(context.Background(), claims.RoomID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Meeting not found"})
+	}
+	if !meetingHasSession(meeting, claims.SessionID) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Session is no longer part of the meeting"})
+	}
+
+	token, err := h.tokens.Issue(claims.RoomID, claims.SessionID, claims.ParticipantID, claims.Username)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to issue join token"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"token": token})
+}
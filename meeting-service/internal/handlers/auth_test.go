@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"meeting-service/internal/auth"
+	"meeting-service/internal/broker"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRevokedParticipantTokens(t *testing.T) {
+	cluster := newTestCluster(t, broker.NewLocal())
+	instance := cluster.instances[0]
+
+	roomId, alice := cluster.createMeeting(t, instance)
+	bob := cluster.join(t, instance, roomId, "bob")
+
+	claims, err := auth.NewTokenManager("test-secret", time.Hour).Verify(alice.token, roomId)
+	if err != nil {
+		t.Fatalf("verifying alice's token: %v", err)
+	}
+	aliceID, _ := primitive.ObjectIDFromHex(claims.ParticipantID)
+	if err := cluster.meetings.RevokeParticipant(context.Background(), roomId, aliceID); err != nil {
+		t.Fatalf("revoking alice: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		p      *testParticipant
+		want   int
+	}{
+		{"live session route", http.MethodPost, "/token", alice, http.StatusUnauthorized},
+		{"moderator route", http.MethodGet, "/attendance", alice, http.StatusUnauthorized},
+		{"other participant", http.MethodPost, "/token", bob, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := authorized(t, tt.method, instance.url+"/meetings/"+roomId+tt.path, tt.p)
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"meeting-service/internal/calendar"
+	"meeting-service/internal/models"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const calendarContentType = "text/calendar; charset=utf-8"
+
+// joinURL is the web app link that opens the join form for the room. Without
+// FRONTEND_URL there is none, the request's Host header is chosen by the
+// client and would let anyone get invites pointing at their own site.
+func (h *MeetingHandler) joinURL(roomID string) string {
+	base := strings.TrimSuffix(h.options.FrontendURL, "/")
+	if base == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/index.html?roomId=%s", base, url.QueryEscape(roomID))
+}
+
+func (h *MeetingHandler) calendarEvent(meeting *models.Meeting) calendar.Event {
+	event := calendar.Event{
+		Meeting: meeting,
+		JoinURL: h.joinURL(meeting.RoomID),
+	}
+	if frontend, err := url.Parse(h.options.FrontendURL); err == nil {
+		event.Host = frontend.Host
+	}
+	return event
+}
+
+// GetMeetingInvite renders the meeting as an iCalendar invite. It needs no
+// token, so like /info it leaves out who created the meeting.
+func (h *MeetingHandler) GetMeetingInvite(c echo.Context) error {
+	roomID := c.Param("roomID")
+
+	meeting, err := h.store.GetMeetingByRoom(context.Background(), roomID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Meeting not found"})
+	}
+
+	event := h.calendarEvent(meeting)
+	event.Public = true
+	ics := calendar.Render([]calendar.Event{event}, time.Now())
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="invite.ics"`)
+	return c.Blob(http.StatusOK, calendarContentType, ics)
+}
+
+// GetUserCalendar is a subscribable feed of every meeting the user created
+func (h *MeetingHandler) GetUserCalendar(c echo.Context) error {
+	creatorID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	meetings, err := h.store.ListMeetingsByCreator(context.Background(), creatorID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list meetings"})
+	}
+
+	events := make([]calendar.Event, 0, len(meetings))
+	for i := range meetings {
+		events = append(events, h.calendarEvent(&meetings[i]))
+	}
+
+	return c.Blob(http.StatusOK, calendarContentType, calendar.Render(events, time.Now()))
+}
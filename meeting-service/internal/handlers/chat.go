@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"meeting-service/internal/models"
+	"meeting-service/internal/store"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// Number of recent chat messages included in room_state
+	roomStateChatHistory = 50
+	defaultChatPageSize  = 50
+	maxChatPageSize      = 200
+	// Different emoji a single message may collect
+	maxChatReactions = 20
+)
+
+var (
+	errRecipientAbsent  = errors.New("recipient is not in this meeting")
+	errNotChatAuthor    = errors.New("only the author can edit this message")
+	errCannotDeleteChat = errors.New("only the author or the host can delete this message")
+	errChatDeleted      = errors.New("this message was deleted")
+)
+
+// ChatReactionPayload is a message after a reaction toggle and the toggle itself
+type ChatReactionPayload struct {
+	*models.ChatMessage
+	Reaction ChatReactionChange `json:"reaction"`
+}
+
+type ChatReactionChange struct {
+	Emoji         string `json:"emoji"`
+	SessionID     string `json:"session_id"`
+	ParticipantID string `json:"participant_id"`
+	Username      string `json:"username"`
+	Added         bool   `json:"added"`
+}
+
+// postChatMessage stores the message before broadcasting it so the ID sent to
+// clients can be used as a paging cursor and to edit, delete or react to it
+func (h *MeetingHandler) postChatMessage(roomId string, rc *RoomConnection, msg *ChatMessageMessage) error {
+	message := models.NewChatMessage(roomId, rc.SessionID, rc.UserID, rc.Username, msg.Content)
+	if msg.ReplyTo != "" {
+		parentID, _ := primitive.ObjectIDFromHex(msg.ReplyTo)
+		parent, err := h.chats.GetChatMessage(context.Background(), roomId, parentID)
+		if err != nil {
+			return err
+		}
+		if !parent.IsVisibleTo(rc.UserID) {
+			return store.ErrChatNotFound
+		}
+		// A public reply would reveal the direct message it quotes
+		if parent.Recipient != nil {
+			return invalidPayload("direct messages cannot be replied to in the room chat")
+		}
+		message.ReplyTo = &parentID
+	}
+
+	// A message that was not stored could never be paged, edited or reacted to
+	if err := h.chats.SaveChatMessage(context.Background(), message); err != nil {
+		return err
+	}
+
+	h.broadcastToRoom(roomId, WebSocketMessage{
+		Type:    "chat_message",
+		Payload: message,
+	})
+	return nil
+}
+
+// editChatMessage lets the author change a message they can still see
+func (h *MeetingHandler) editChatMessage(roomId string, rc *RoomConnection, msg *ChatEditMessage) error {
+	id, _ := primitive.ObjectIDFromHex(msg.MessageID)
+	message, err := h.chats.UpdateChatMessage(context.Background(), roomId, id, func(message *models.ChatMessage) error {
+		if err := checkChatChange(message, rc); err != nil {
+			return err
+		}
+		if !message.IsAuthor(rc.UserID, rc.SessionID) {
+			return errNotChatAuthor
+		}
+		message.Edit(msg.Content, time.Now())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	h.sendChatUpdate(roomId, WebSocketMessage{Type: "chat_edited", Payload: message}, message)
+	return nil
+}
+
+// deleteChatMessage removes a message for everyone, the author may delete
+// their own and the host any
+func (h *MeetingHandler) deleteChatMessage(roomId string, rc *RoomConnection, msg *ChatDeleteMessage) error {
+	meeting, err := h.store.GetMeetingByRoom(context.Background(), roomId)
+	if err != nil {
+		return err
+	}
+	isHost := meeting.RoleOf(rc.UserID) == models.RoleHost
+
+	id, _ := primitive.ObjectIDFromHex(msg.MessageID)
+	message, err := h.chats.UpdateChatMessage(context.Background(), roomId, id, func(message *models.ChatMessage) error {
+		if err := checkChatChange(message, rc); err != nil {
+			return err
+		}
+		if !isHost && !message.IsAuthor(rc.UserID, rc.SessionID) {
+			return errCannotDeleteChat
+		}
+		message.Delete(time.Now())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	h.sendChatUpdate(roomId, WebSocketMessage{Type: "chat_deleted", Payload: message}, message)
+	return nil
+}
+
+// reactToChatMessage toggles the sender's reaction, everyone who sees the
+// message gets the new counts
+func (h *MeetingHandler) reactToChatMessage(roomId string, rc *RoomConnection, msg *ChatReactMessage) error {
+	var added bool
+	id, _ := primitive.ObjectIDFromHex(msg.MessageID)
+	message, err := h.chats.UpdateChatMessage(context.Background(), roomId, id, func(message *models.ChatMessage) error {
+		if err := checkChatChange(message, rc); err != nil {
+			return err
+		}
+		added = message.ToggleReaction(msg.Emoji, rc.UserID)
+		if len(message.Reactions) > maxChatReactions {
+			return invalidPayload("a message can have at most %d different reactions", maxChatReactions)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	h.sendChatUpdate(roomId, WebSocketMessage{
+		Type: "chat_reacted",
+		Payload: ChatReactionPayload{
+			ChatMessage: message,
+			Reaction: ChatReactionChange{
+				Emoji:         msg.Emoji,
+				SessionID:     rc.SessionID,
+				ParticipantID: rc.UserID.Hex(),
+				Username:      rc.Username,
+				Added:         added,
+			},
+		},
+	}, message)
+	return nil
+}
+
+// checkChatChange rejects changes to messages the sender can't see or that
+// were deleted
+func checkChatChange(message *models.ChatMessage, rc *RoomConnection) error {
+	if !message.IsVisibleTo(rc.UserID) {
+		return store.ErrChatNotFound
+	}
+	if message.DeletedAt != nil {
+		return errChatDeleted
+	}
+	return nil
+}
+
+// sendChatUpdate delivers a change to a message to everyone who can see it
+func (h *MeetingHandler) sendChatUpdate(roomId string, msg WebSocketMessage, message *models.ChatMessage) {
+	if len(message.VisibleTo) == 0 {
+		h.broadcastToRoom(roomId, msg)
+		return
+	}
+
+	meeting, err := h.store.GetMeetingByRoom(context.Background(), roomId)
+	if err != nil {
+		h.roomLogger(roomId).Error("Error fetching meeting for chat update", "error", err)
+		return
+	}
+	var to []string
+	for _, session := range meeting.Sessions {
+		if message.IsVisibleTo(session.UserID) {
+			to = append(to, session.SessionID)
+		}
+	}
+	h.hub.SendTo(roomId, to, msg)
+}
+
+// postDirectMessage sends a message to one session, or to every session of a
+// participant, and echoes it to the sender. Nobody else receives it or sees
+// it in the history.
+func (h *MeetingHandler) postDirectMessage(roomId string, rc *RoomConnection, msg *DirectMessageMessage) error {
+	meeting, err := h.store.GetMeetingByRoom(context.Background(), roomId)
+	if err != nil {
+		return err
+	}
+
+	var recipients []models.Session
+	if msg.SessionID != "" {
+		if session := meeting.FindSession(msg.SessionID); session != nil {
+			recipients = append(recipients, *session)
+		}
+	} else {
+		participantID, err := primitive.ObjectIDFromHex(msg.ParticipantID)
+		if err != nil {
+			return invalidPayload("participant_id is not a valid ID")
+		}
+		for _, session := range meeting.Sessions {
+			if session.UserID == participantID {
+				recipients = append(recipients, session)
+			}
+		}
+	}
+	if len(recipients) == 0 {
+		return errRecipientAbsent
+	}
+	if recipients[0].UserID == rc.UserID {
+		return invalidPayload("you cannot send a direct message to yourself")
+	}
+
+	message := models.NewChatMessage(roomId, rc.SessionID, rc.UserID, rc.Username, msg.Content)
+	message.DirectTo(models.ChatRecipient{
+		SessionID:     msg.SessionID,
+		ParticipantID: recipients[0].UserID,
+		Username:      recipients[0].Username,
+	})
+	if err := h.chats.SaveChatMessage(context.Background(), message); err != nil {
+		return err
+	}
+
+	to := []string{rc.SessionID}
+	for _, session := range recipients {
+		to = append(to, session.SessionID)
+	}
+	h.hub.SendTo(roomId, to, WebSocketMessage{
+		Type:    "direct_message",
+		Payload: message,
+	})
+	return nil
+}
+
+// GetChatHistory pages backwards through a room's chat, pass the returned
+// next_before to get the previous page
+func (h *MeetingHandler) GetChatHistory(c echo.Context) error {
+	roomId := c.Param("roomId")
+
+	viewer, err := primitive.ObjectIDFromHex(joinClaims(c).ParticipantID)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid join token"})
+	}
+
+	var before primitive.ObjectID
+	if cursor := c.QueryParam("before"); cursor != "" {
+		id, err := primitive.ObjectIDFromHex(cursor)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid before cursor"})
+		}
+		before = id
+	}
+
+	limit := defaultChatPageSize
+	if value := c.QueryParam("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit"})
+		}
+		if n > maxChatPageSize {
+			n = maxChatPageSize
+		}
+		limit = n
+	}
+
+	messages, err := h.chats.ListChatMessages(context.Background(), roomId, viewer, before, limit)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load chat history"})
+	}
+
+	nextBefore := ""
+	if len(messages) == limit {
+		nextBefore = messages[0].ID.Hex()
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"messages":    messages,
+		"next_before": nextBefore,
+	})
+}
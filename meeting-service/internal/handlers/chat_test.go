@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"testing"
+
+	"meeting-service/internal/broker"
+	"meeting-service/internal/models"
+)
+
+// send writes a client message with the id the error would refer back to
+func send(t *testing.T, p *testParticipant, msgType string, payload interface{}) {
+	t.Helper()
+
+	err := p.conn.WriteJSON(map[string]interface{}{"type": msgType, "id": "1", "payload": payload})
+	if err != nil {
+		t.Fatalf("sending %s: %v", msgType, err)
+	}
+}
+
+// post sends a message of the type and returns it as echoed to the sender
+func post(t *testing.T, p *testParticipant, msgType string, payload interface{}) *models.ChatMessage {
+	t.Helper()
+
+	send(t, p, msgType, payload)
+	var msg struct {
+		Payload models.ChatMessage `json:"payload"`
+	}
+	expect(t, p.conn, msgType, &msg)
+	return &msg.Payload
+}
+
+// expectChange reads until the change to the message arrives, changes to
+// other messages may still be queued
+func expectChange(t *testing.T, p *testParticipant, msgType string, message *models.ChatMessage) {
+	t.Helper()
+
+	for {
+		var changed struct {
+			Payload models.ChatMessage `json:"payload"`
+		}
+		expect(t, p.conn, msgType, &changed)
+		if changed.Payload.ID == message.ID {
+			return
+		}
+	}
+}
+
+func TestChatChangePermissions(t *testing.T) {
+	cluster := newTestCluster(t, broker.NewLocal())
+	instance := cluster.instances[0]
+
+	// alice is the host, carol a co-host, bob and dave participants
+	roomId, alice := cluster.createMeeting(t, instance)
+	bob := cluster.join(t, instance, roomId, "bob")
+	carol := cluster.join(t, instance, roomId, "carol")
+	dave := cluster.join(t, instance, roomId, "dave")
+	send(t, alice, "promote_participant", ParticipantActionMessage{SessionID: carol.sessionID})
+	expect(t, carol.conn, "participant_promoted", nil)
+
+	tests := []struct {
+		name      string
+		actor     *testParticipant
+		direct    bool
+		deleted   bool
+		msgType   string
+		wantEvent string
+		wantCode  string
+	}{
+		{"author edits", bob, false, false, "chat_edit", "chat_edited", ""},
+		{"host edits", alice, false, false, "chat_edit", "", ErrCodeForbidden},
+		{"co-host edits", carol, false, false, "chat_edit", "", ErrCodeForbidden},
+		{"participant edits", dave, false, false, "chat_edit", "", ErrCodeForbidden},
+		{"author edits a deleted message", bob, false, true, "chat_edit", "", ErrCodeConflict},
+
+		{"author deletes", bob, false, false, "chat_delete", "chat_deleted", ""},
+		{"host deletes", alice, false, false, "chat_delete", "chat_deleted", ""},
+		{"co-host deletes", carol, false, false, "chat_delete", "", ErrCodeForbidden},
+		{"participant deletes", dave, false, false, "chat_delete", "", ErrCodeForbidden},
+		{"host deletes a direct message between others", alice, true, false, "chat_delete", "", ErrCodeNotFound},
+
+		{"participant reacts", dave, false, false, "chat_react", "chat_reacted", ""},
+		{"author reacts", bob, false, false, "chat_react", "chat_reacted", ""},
+		{"recipient reacts to a direct message", carol, true, false, "chat_react", "chat_reacted", ""},
+		{"outsider reacts to a direct message", dave, true, false, "chat_react", "", ErrCodeNotFound},
+		{"participant reacts to a deleted message", dave, false, true, "chat_react", "", ErrCodeConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Every case gets a fresh message from bob, direct ones go to carol
+			var message *models.ChatMessage
+			if tt.direct {
+				message = post(t, bob, "direct_message", DirectMessageMessage{SessionID: carol.sessionID, Content: "psst"})
+			} else {
+				message = post(t, bob, "chat_message", ChatMessageMessage{Content: "hello"})
+			}
+			id := message.ID.Hex()
+			if tt.deleted {
+				send(t, bob, "chat_delete", ChatDeleteMessage{MessageID: id})
+				expectChange(t, bob, "chat_deleted", message)
+			}
+
+			switch tt.msgType {
+			case "chat_edit":
+				send(t, tt.actor, tt.msgType, ChatEditMessage{MessageID: id, Content: "edited"})
+			case "chat_delete":
+				send(t, tt.actor, tt.msgType, ChatDeleteMessage{MessageID: id})
+			case "chat_react":
+				send(t, tt.actor, tt.msgType, ChatReactMessage{MessageID: id, Emoji: "👍"})
+			}
+
+			if tt.wantCode != "" {
+				if got := expectError(t, tt.actor); got.Code != tt.wantCode {
+					t.Errorf("error code %q (%s), want %q", got.Code, got.Message, tt.wantCode)
+				}
+				return
+			}
+			// Changes to the messages of earlier cases may still be queued
+			for {
+				var changed struct {
+					Payload models.ChatMessage `json:"payload"`
+				}
+				expect(t, tt.actor.conn, tt.wantEvent, &changed)
+				if changed.Payload.ID == message.ID {
+					return
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Each readiness check gets this long before it counts as down
+const healthCheckTimeout = 2 * time.Second
+
+var errDraining = errors.New("server is shutting down")
+
+// HealthCheck is one dependency reported by /readyz. Only required checks
+// make the instance unready, the others are reported for visibility.
+type HealthCheck struct {
+	Name     string
+	Required bool
+	Check    func(ctx context.Context) error
+}
+
+// DependencyStatus is the result of one check
+type DependencyStatus struct {
+	Status    string `json:"status"`
+	Required  bool   `json:"required"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type HealthHandler struct {
+	checks []HealthCheck
+}
+
+func NewHealthHandler(checks []HealthCheck) *HealthHandler {
+	return &HealthHandler{checks: checks}
+}
+
+// Healthz reports that the process is alive, it never checks dependencies
+func (h *HealthHandler) Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz runs every check concurrently and answers 503 when a required one
+// fails, so the orchestrator stops routing traffic here
+func (h *HealthHandler) Readyz(c echo.Context) error {
+	results := make(map[string]DependencyStatus, len(h.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, check := range h.checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(c.Request().Context(), healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Check(ctx)
+			status := DependencyStatus{
+				Status:    "up",
+				Required:  check.Required,
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				status.Status = "down"
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			results[check.Name] = status
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	code, overall := http.StatusOK, "ready"
+	for _, result := range results {
+		if result.Required && result.Status != "up" {
+			code, overall = http.StatusServiceUnavailable, "unavailable"
+		}
+	}
+
+	return c.JSON(code, map[string]interface{}{
+		"status":       overall,
+		"dependencies": results,
+	})
+}
+
+// CheckAcceptingJoins is a readiness check that fails once shutdown started
+func (h *MeetingHandler) CheckAcceptingJoins(ctx context.Context) error {
+	if h.isDraining() {
+		return errDraining
+	}
+	return nil
+}
@@ -0,0 +1,497 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"meeting-service/internal/broker"
+	"meeting-service/internal/metrics"
+	"meeting-service/internal/models"
+
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// Time allowed to write a single message to the peer
+	writeWait = 10 * time.Second
+	// Interval between server pings, must be shorter than the 60s read deadline
+	pingPeriod = 30 * time.Second
+)
+
+// RoomConnection is a participant's WebSocket in a room. Only writePump writes
+// data frames to Conn, everything else goes through the send channel.
+type RoomConnection struct {
+	Username  string
+	SessionID string
+	UserID    primitive.ObjectID
+	Conn      *websocket.Conn
+	// Protocol is the WebSocket protocol version agreed at connect
+	Protocol int
+	// resumeToken lets the client resume this connection's session
+	resumeToken string
+	// superseded is set once a newer connection resumed the session
+	superseded bool
+	// log carries the room, session and username of the connection
+	log *slog.Logger
+
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	closeCode int
+	closeText string
+}
+
+// newRoomConnection logs through the upgrade request's logger, it already
+// carries the room, session and username
+func newRoomConnection(ws *websocket.Conn, session *models.Session, backlog int, logger *slog.Logger) *RoomConnection {
+	return &RoomConnection{
+		Username:  session.Username,
+		SessionID: session.SessionID,
+		UserID:    session.UserID,
+		Conn:      ws,
+		log:       logger,
+		send:      make(chan []byte, backlog),
+		done:      make(chan struct{}),
+		closeCode: websocket.CloseNormalClosure,
+	}
+}
+
+// Send queues a message for the writer goroutine. A connection whose backlog
+// is full is considered too slow and gets dropped instead of blocking the caller.
+func (rc *RoomConnection) Send(msg WebSocketMessage) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		rc.log.Error("Error encoding message", "type", msg.Type, "error", err)
+		return false
+	}
+	if !rc.sendRaw(data) {
+		return false
+	}
+	metrics.WSMessagesSent(msg.Type, 1)
+	return true
+}
+
+func (rc *RoomConnection) sendRaw(data []byte) bool {
+	select {
+	case <-rc.done:
+		return false
+	default:
+	}
+
+	select {
+	case rc.send <- data:
+		return true
+	default:
+		rc.log.Warn("Dropping slow connection")
+		rc.CloseWithReason(websocket.ClosePolicyViolation, "slow consumer")
+		return false
+	}
+}
+
+// closing reports whether the server already closed the connection
+func (rc *RoomConnection) closing() bool {
+	select {
+	case <-rc.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops the writer, which sends a close frame and closes the socket
+func (rc *RoomConnection) Close() {
+	rc.CloseWithReason(websocket.CloseNormalClosure, "")
+}
+
+func (rc *RoomConnection) CloseWithReason(code int, text string) {
+	rc.closeOnce.Do(func() {
+		rc.closeCode = code
+		rc.closeText = text
+		close(rc.done)
+	})
+}
+
+// writePump drains the send channel and owns all data writes and pings on Conn
+func (rc *RoomConnection) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		rc.Conn.Close()
+	}()
+
+	for {
+		select {
+		case data := <-rc.send:
+			rc.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := rc.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				rc.log.Warn("WebSocket write error", "error", err)
+				rc.Close()
+				return
+			}
+		case <-ticker.C:
+			if err := rc.Conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(writeWait)); err != nil {
+				rc.log.Warn("Heartbeat error", "error", err)
+				rc.Close()
+				return
+			}
+		case <-rc.done:
+			// Flush what is already queued so final events still reach the client
+			rc.flush()
+			rc.Conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(rc.closeCode, rc.closeText),
+				time.Now().Add(time.Second),
+			)
+			return
+		}
+	}
+}
+
+func (rc *RoomConnection) flush() {
+	for {
+		select {
+		case data := <-rc.send:
+			rc.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := rc.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Hub tracks the connections of every room and fans messages out to them.
+// Broadcasts go through the broker so connections on other instances get
+// them too, each instance delivers what it receives to its own connections.
+type Hub struct {
+	mu    sync.RWMutex
+	rooms map[string]map[*RoomConnection]struct{}
+	// logs number each room's broadcasts and keep the latest for resumes.
+	// The numbers are this instance's own, only it can replay them.
+	logs    map[string]*replayLog
+	broker  broker.Broker
+	backlog int
+	replay  int
+	logger  *slog.Logger
+	// notices handle the messages instances send each other
+	notices map[string]func(roomId string, payload json.RawMessage)
+}
+
+// brokerMessage is a broadcast as it travels through the broker, the payload
+// is passed on to the connections as is
+type brokerMessage struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+	// To limits delivery to these sessions, everyone in the room when empty
+	To []string `json:"to,omitempty"`
+	// Close asks every instance to close the addressed connections with this
+	// code, Type then carries the close reason
+	Close int `json:"close,omitempty"`
+	// Notice marks a message for the instances themselves, it is handed to
+	// the handler registered for Type and never reaches a client
+	Notice bool `json:"notice,omitempty"`
+}
+
+// NewHub creates a hub whose connections buffer up to backlog outbound
+// messages and that keeps the last replay broadcasts of every room. Start
+// subscribes it to the broker.
+func NewHub(backlog, replay int, broker broker.Broker, logger *slog.Logger) *Hub {
+	if backlog <= 0 {
+		backlog = 256
+	}
+	if replay <= 0 {
+		replay = 128
+	}
+	return &Hub{
+		rooms:   make(map[string]map[*RoomConnection]struct{}),
+		logs:    make(map[string]*replayLog),
+		broker:  broker,
+		backlog: backlog,
+		replay:  replay,
+		logger:  logger,
+		notices: make(map[string]func(roomId string, payload json.RawMessage)),
+	}
+}
+
+// HandleNotice registers the handler for the notices of a kind
+func (hub *Hub) HandleNotice(kind string, handle func(roomId string, payload json.RawMessage)) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	hub.notices[kind] = handle
+}
+
+// Start delivers the broadcasts of every instance to this hub's connections
+func (hub *Hub) Start() error {
+	return hub.broker.Subscribe(func(roomId string, data []byte) {
+		var msg brokerMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			hub.logger.Error("Error decoding broker message", "room_id", roomId, "error", err)
+			return
+		}
+		switch {
+		case msg.Notice:
+			hub.mu.RLock()
+			handle := hub.notices[msg.Type]
+			hub.mu.RUnlock()
+			if handle != nil {
+				handle(roomId, msg.Payload)
+			}
+		case msg.Close != 0:
+			hub.disconnect(roomId, msg.To, msg.Close, msg.Type)
+		default:
+			hub.deliver(roomId, WebSocketMessage{Type: msg.Type, Payload: msg.Payload}, msg.To)
+		}
+	})
+}
+
+// replayLog is a ring of a room's most recent broadcasts, indexed by sequence
+type replayLog struct {
+	seq     uint64
+	entries []replayEntry
+}
+
+type replayEntry struct {
+	data []byte
+	// to is the sessions a targeted message was for
+	to []string
+}
+
+func (l *replayLog) append(data []byte, to []string) {
+	l.entries[l.seq%uint64(len(l.entries))] = replayEntry{data: data, to: to}
+}
+
+// since returns the messages for the session after seq, false when some are
+// no longer kept
+func (l *replayLog) since(seq uint64, sessionID string) ([][]byte, bool) {
+	if seq > l.seq || l.seq-seq > uint64(len(l.entries)) {
+		return nil, false
+	}
+	var missed [][]byte
+	for s := seq + 1; s <= l.seq; s++ {
+		entry := l.entries[s%uint64(len(l.entries))]
+		if addressedTo(entry.to, sessionID) {
+			missed = append(missed, entry.data)
+		}
+	}
+	return missed, true
+}
+
+// addressedTo reports whether a message for to reaches the session
+func addressedTo(to []string, sessionID string) bool {
+	if len(to) == 0 {
+		return true
+	}
+	for _, id := range to {
+		if id == sessionID {
+			return true
+		}
+	}
+	return false
+}
+
+// Register adds the connection to the room and starts its writer. The message
+// built by hello is queued first and gets the room's current sequence. A
+// resuming connection passes the last sequence it saw and has the broadcasts
+// it missed queued right behind, replayed is false when they were not all kept.
+func (hub *Hub) Register(roomId string, rc *RoomConnection, resumeAfter *uint64, hello func(seq uint64, replayed bool) WebSocketMessage) (replayed bool) {
+	hub.mu.Lock()
+	if hub.rooms[roomId] == nil {
+		hub.rooms[roomId] = make(map[*RoomConnection]struct{})
+	}
+	log := hub.logs[roomId]
+	if log == nil {
+		log = &replayLog{entries: make([]replayEntry, hub.replay)}
+		hub.logs[roomId] = log
+	}
+
+	var missed [][]byte
+	if resumeAfter != nil {
+		missed, replayed = log.since(*resumeAfter, rc.SessionID)
+		// The replay has to fit in the connection's backlog next to the hello
+		if len(missed) >= cap(rc.send) {
+			missed, replayed = nil, false
+		}
+	}
+	rc.Send(hello(log.seq, replayed))
+	for _, data := range missed {
+		rc.sendRaw(data)
+	}
+	hub.rooms[roomId][rc] = struct{}{}
+	hub.mu.Unlock()
+
+	go rc.writePump()
+	return replayed
+}
+
+// Forget drops the room's sequence and replay buffer once nobody can resume
+func (hub *Hub) Forget(roomId string) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	if len(hub.rooms[roomId]) == 0 {
+		delete(hub.logs, roomId)
+	}
+}
+
+// Unregister removes the connection and reports whether the room is now empty
+func (hub *Hub) Unregister(roomId string, rc *RoomConnection) bool {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	delete(hub.rooms[roomId], rc)
+	if len(hub.rooms[roomId]) == 0 {
+		delete(hub.rooms, roomId)
+		return true
+	}
+	return false
+}
+
+// Connections returns a snapshot of the room's connections
+func (hub *Hub) Connections(roomId string) []*RoomConnection {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	conns := make([]*RoomConnection, 0, len(hub.rooms[roomId]))
+	for rc := range hub.rooms[roomId] {
+		conns = append(conns, rc)
+	}
+	return conns
+}
+
+// All returns a snapshot of every connection in every room
+func (hub *Hub) All() []*RoomConnection {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	var conns []*RoomConnection
+	for _, room := range hub.rooms {
+		for rc := range room {
+			conns = append(conns, rc)
+		}
+	}
+	return conns
+}
+
+// Standalone reports whether the hub uses the in-process broker, so no other
+// instance shares its rooms
+func (hub *Hub) Standalone() bool {
+	_, local := hub.broker.(*broker.Local)
+	return local
+}
+
+// Broadcast publishes the message to the room on every instance
+func (hub *Hub) Broadcast(roomId string, msg WebSocketMessage) {
+	hub.publish(roomId, msg, nil)
+}
+
+// SendTo publishes the message to the connections of the given sessions only,
+// wherever they are connected
+func (hub *Hub) SendTo(roomId string, sessionIDs []string, msg WebSocketMessage) {
+	if len(sessionIDs) == 0 {
+		return
+	}
+	hub.publish(roomId, msg, sessionIDs)
+}
+
+// BroadcastLocal sends the message to the room's connections on this instance
+// only, for state every instance derives on its own
+func (hub *Hub) BroadcastLocal(roomId string, msg WebSocketMessage) {
+	hub.deliver(roomId, msg, nil)
+}
+
+// Disconnect closes the connections of the given sessions, everyone in the
+// room when nil, wherever they are connected. Messages published before
+// still reach them first.
+func (hub *Hub) Disconnect(roomId string, sessionIDs []string, code int, reason string) {
+	hub.send(roomId, brokerMessage{Type: reason, To: sessionIDs, Close: code})
+}
+
+// Notify publishes a notice to the handlers of every instance, this one included
+func (hub *Hub) Notify(roomId, kind string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		hub.logger.Error("Error encoding notice", "room_id", roomId, "kind", kind, "error", err)
+		return
+	}
+	hub.send(roomId, brokerMessage{Type: kind, Payload: data, Notice: true})
+}
+
+func (hub *Hub) publish(roomId string, msg WebSocketMessage, to []string) {
+	payload, err := json.Marshal(msg.Payload)
+	if err != nil {
+		hub.logger.Error("Error publishing message", "room_id", roomId, "type", msg.Type, "error", err)
+		return
+	}
+	hub.send(roomId, brokerMessage{Type: msg.Type, Payload: payload, To: to})
+}
+
+func (hub *Hub) send(roomId string, msg brokerMessage) {
+	data, err := json.Marshal(msg)
+	if err == nil {
+		err = hub.broker.Publish(context.Background(), roomId, data)
+	}
+	if err != nil {
+		hub.logger.Error("Error publishing message", "room_id", roomId, "type", msg.Type, "error", err)
+	}
+}
+
+// disconnect closes the addressed connections on this instance. Taking the
+// lock orders it after every message already delivered to the room.
+func (hub *Hub) disconnect(roomId string, to []string, code int, reason string) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	for rc := range hub.rooms[roomId] {
+		if addressedTo(to, rc.SessionID) {
+			rc.CloseWithReason(code, reason)
+		}
+	}
+}
+
+// deliver numbers the message, encodes it once and queues it on every local
+// connection in the room it is addressed to. The lock is held throughout so
+// every connection sees the room's messages in sequence order, which is fine
+// as no network I/O happens here and slow connections are dropped by sendRaw.
+func (hub *Hub) deliver(roomId string, msg WebSocketMessage, to []string) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	log := hub.logs[roomId]
+	if log != nil {
+		msg.Seq = log.seq + 1
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		hub.logger.Error("Error encoding message", "room_id", roomId, "type", msg.Type, "error", err)
+		return
+	}
+	if log != nil {
+		log.seq++
+		log.append(data, to)
+	}
+
+	sent := 0
+	for rc := range hub.rooms[roomId] {
+		if addressedTo(to, rc.SessionID) && rc.sendRaw(data) {
+			sent++
+		}
+	}
+	metrics.WSMessagesSent(msg.Type, sent)
+}
+
+// Stats counts the active rooms and their connections
+func (hub *Hub) Stats() (rooms, connections int) {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+
+	for _, conns := range hub.rooms {
+		connections += len(conns)
+	}
+	return len(hub.rooms), connections
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"meeting-service/internal/auth"
+	"meeting-service/internal/broker"
+	"meeting-service/internal/models"
+	"meeting-service/internal/services"
+	"meeting-service/internal/store"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+)
+
+// How long a test waits for a message to arrive through the broker
+const deliveryTimeout = 5 * time.Second
+
+// testInstance is one replica of the service, all replicas of a test share
+// the meeting store and the broker
+type testInstance struct {
+	hub     *Hub
+	handler *MeetingHandler
+	url     string
+}
+
+type testCluster struct {
+	instances []*testInstance
+	meetings  *store.MemoryMeetingStore
+}
+
+func newTestCluster(t *testing.T, brokers ...broker.Broker) *testCluster {
+	t.Helper()
+
+	var sessions int64
+	cloudflare := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"sessionId":"session-%d"}`, atomic.AddInt64(&sessions, 1))
+	}))
+	t.Cleanup(cloudflare.Close)
+	cloudflareService := services.NewCloudflareService("app", "token")
+	cloudflareService.BaseURL = cloudflare.URL
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tokens := auth.NewTokenManager("test-secret", time.Hour)
+	cluster := &testCluster{meetings: store.NewMemoryMeetingStore()}
+	for _, b := range brokers {
+		hub := NewHub(64, 16, b, logger)
+		h := NewMeetingHandler(cluster.meetings, store.NewMemoryChatStore(), cloudflareService, tokens, hub,
+			store.NewMemoryAttendanceStore(), store.NewMemorySpeakingStore(), nil, Options{Logger: logger})
+		if err := hub.Start(); err != nil {
+			t.Fatalf("starting hub: %v", err)
+		}
+
+		e := echo.New()
+		e.POST("/meetings", h.CreateMeeting)
+		e.GET("/meetings/:roomID", h.JoinMeeting)
+		e.GET("/ws/meetings/:roomId", h.HandleWebSocket, h.RequireJoinToken)
+		e.POST("/meetings/:roomId/end", h.EndMeeting, h.RequireJoinToken)
+		e.GET("/meetings/:roomId/attendance", h.GetAttendance, h.RequireModeratorToken)
+		e.GET("/meetings/:roomId/lobby/:requestId", h.GetLobbyStatus)
+		e.POST("/meetings/:roomId/token", h.RefreshToken, h.RequireJoinToken)
+		server := httptest.NewServer(e)
+		t.Cleanup(server.Close)
+
+		cluster.instances = append(cluster.instances, &testInstance{hub: hub, handler: h, url: server.URL})
+	}
+	return cluster
+}
+
+type testParticipant struct {
+	sessionID string
+	token     string
+	conn      *websocket.Conn
+}
+
+// createMeeting creates a meeting on the instance and connects its host there
+func (c *testCluster) createMeeting(t *testing.T, instance *testInstance) (string, *testParticipant) {
+	t.Helper()
+
+	resp, err := http.Post(instance.url+"/meetings", "application/json",
+		bytes.NewBufferString(`{"title":"Standup","username":"alice"}`))
+	if err != nil {
+		t.Fatalf("creating meeting: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var created struct {
+		RoomID string `json:"room_id"`
+		Token  string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decoding meeting: %v", err)
+	}
+	return created.RoomID, connect(t, instance, created.RoomID, created.Token)
+}
+
+// join adds a participant to the meeting and connects them to the instance
+func (c *testCluster) join(t *testing.T, instance *testInstance, roomId, username string) *testParticipant {
+	t.Helper()
+
+	resp, err := http.Get(instance.url + "/meetings/" + roomId + "?username=" + username)
+	if err != nil {
+		t.Fatalf("joining meeting: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var joined struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&joined); err != nil {
+		t.Fatalf("decoding join: %v", err)
+	}
+	return connect(t, instance, roomId, joined.Token)
+}
+
+func connect(t *testing.T, instance *testInstance, roomId, token string) *testParticipant {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(instance.url, "http") + "/ws/meetings/" + roomId + "?token=" + token
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("connecting: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var hello struct {
+		Payload HelloPayload `json:"payload"`
+	}
+	expect(t, conn, "hello", &hello)
+	return &testParticipant{sessionID: hello.Payload.SessionID, token: token, conn: conn}
+}
+
+// expect reads until a message of the type arrives and decodes it into v
+func expect(t *testing.T, conn *websocket.Conn, msgType string, v interface{}) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(deliveryTimeout))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", msgType, err)
+		}
+		var msg struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("decoding message: %v", err)
+		}
+		if msg.Type != msgType {
+			continue
+		}
+		if v != nil {
+			if err := json.Unmarshal(data, v); err != nil {
+				t.Fatalf("decoding %s: %v", msgType, err)
+			}
+		}
+		return
+	}
+}
+
+// expectBefore reads until the marker arrives and fails on a message of the
+// type in between
+func expectBefore(t *testing.T, conn *websocket.Conn, unwanted, marker string) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(deliveryTimeout))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", marker, err)
+		}
+		var msg struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal(data, &msg)
+		switch msg.Type {
+		case unwanted:
+			t.Fatalf("got %s that was not addressed to the connection", unwanted)
+		case marker:
+			return
+		}
+	}
+}
+
+func runNATS(t *testing.T) string {
+	t.Helper()
+
+	server, err := natsserver.NewServer(&natsserver.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Skipf("embedded NATS server unavailable: %v", err)
+	}
+	go server.Start()
+	if !server.ReadyForConnections(deliveryTimeout) {
+		t.Skip("embedded NATS server did not start")
+	}
+	t.Cleanup(server.Shutdown)
+	return server.ClientURL()
+}
+
+// testBrokers connect two replicas, either in process or through an embedded
+// NATS server
+func testBrokers() map[string]func(t *testing.T) []broker.Broker {
+	return map[string]func(t *testing.T) []broker.Broker{
+		"local": func(t *testing.T) []broker.Broker {
+			shared := broker.NewLocal()
+			return []broker.Broker{shared, shared}
+		},
+		"nats": func(t *testing.T) []broker.Broker {
+			url := runNATS(t)
+			var brokers []broker.Broker
+			for i := 0; i < 2; i++ {
+				b, err := broker.NewNATS(url, "test", slog.New(slog.NewTextHandler(io.Discard, nil)))
+				if err != nil {
+					t.Fatalf("connecting to NATS: %v", err)
+				}
+				t.Cleanup(func() { b.Close() })
+				brokers = append(brokers, b)
+			}
+			return brokers
+		},
+	}
+}
+
+func TestHubsShareRoom(t *testing.T) {
+	for name, brokers := range testBrokers() {
+		t.Run(name, func(t *testing.T) {
+			cluster := newTestCluster(t, brokers(t)...)
+			a, b := cluster.instances[0], cluster.instances[1]
+
+			// alice and carol are on A, bob is on B
+			roomId, alice := cluster.createMeeting(t, a)
+			bob := cluster.join(t, b, roomId, "bob")
+			carol := cluster.join(t, a, roomId, "carol")
+
+			t.Run("broadcast", func(t *testing.T) {
+				b.hub.Broadcast(roomId, WebSocketMessage{Type: "wave", Payload: WavePayload{Username: "bob"}})
+				for _, p := range []*testParticipant{alice, bob, carol} {
+					var wave struct {
+						Payload WavePayload `json:"payload"`
+					}
+					expect(t, p.conn, "wave", &wave)
+					if wave.Payload.Username != "bob" {
+						t.Errorf("wave from %q, want bob", wave.Payload.Username)
+					}
+				}
+			})
+
+			t.Run("send to", func(t *testing.T) {
+				a.hub.SendTo(roomId, []string{alice.sessionID, bob.sessionID}, WebSocketMessage{Type: "lobby_request"})
+				a.hub.Broadcast(roomId, WebSocketMessage{Type: "marker"})
+				expect(t, alice.conn, "lobby_request", nil)
+				expect(t, bob.conn, "lobby_request", nil)
+				expectBefore(t, carol.conn, "lobby_request", "marker")
+			})
+
+			t.Run("chat message", func(t *testing.T) {
+				err := alice.conn.WriteJSON(map[string]interface{}{
+					"type":    "chat_message",
+					"payload": ChatMessageMessage{Content: "hello from A"},
+				})
+				if err != nil {
+					t.Fatalf("sending chat message: %v", err)
+				}
+				for _, p := range []*testParticipant{alice, bob, carol} {
+					var chat struct {
+						Payload models.ChatMessage `json:"payload"`
+					}
+					expect(t, p.conn, "chat_message", &chat)
+					if chat.Payload.Content != "hello from A" {
+						t.Errorf("chat content %q, want %q", chat.Payload.Content, "hello from A")
+					}
+				}
+			})
+		})
+	}
+}
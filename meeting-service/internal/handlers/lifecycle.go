@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"meeting-service/internal/models"
+	"meeting-service/internal/services"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Close code sent to everyone when the host ends the meeting
+const closeMeetingEnded = 4002
+
+// meetingEnded reports whether the meeting was ended. A recurring meeting
+// opens again for occurrences whose join window starts after it was ended.
+func (h *MeetingHandler) meetingEnded(meeting *models.Meeting, now time.Time) bool {
+	if meeting.EndedAt == nil {
+		return false
+	}
+	if meeting.Schedule == nil {
+		return true
+	}
+	next, ok := meeting.Schedule.Current(now.Add(-h.options.JoinWindow))
+	if !ok {
+		return true
+	}
+	return !next.StartTime.Add(-h.options.JoinWindow).After(*meeting.EndedAt)
+}
+
+// endMeeting lets the host end the meeting for everyone
+func (h *MeetingHandler) endMeeting(ctx context.Context, roomId, actorSessionID string) error {
+	meeting, err := h.store.GetMeetingByRoom(ctx, roomId)
+	if err != nil {
+		return err
+	}
+
+	actor := meeting.FindSession(actorSessionID)
+	if actor == nil || meeting.RoleOf(actor.UserID) != models.RoleHost {
+		return errHostOnly
+	}
+
+	before, err := h.store.EndMeeting(ctx, roomId, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// Every instance closes its sockets after the event, which the writer
+	// flushes before the close frame
+	h.broadcastToRoom(roomId, WebSocketMessage{
+		Type:    "meeting_ended",
+		Payload: map[string]string{"by": actor.Username},
+	})
+	h.hub.Disconnect(roomId, nil, closeMeetingEnded, "meeting ended")
+	h.emitWebhook(roomId, models.EventMeetingEnded, map[string]string{
+		"by": actor.Username,
+	})
+
+	for i := range before.Sessions {
+		h.recordAttendance(roomId, &before.Sessions[i], models.AttendanceLeave)
+	}
+	if len(before.Sessions) > 0 {
+		h.roomEmptied(roomId)
+	}
+	go h.closeSessionTracks(roomId, before.Sessions)
+	return nil
+}
+
+// closeSessionTracks force closes every track still open on the sessions
+func (h *MeetingHandler) closeSessionTracks(roomId string, sessions []models.Session) {
+	for _, session := range sessions {
+		h.closeTracks(roomId, session.SessionID, func(string) bool { return true })
+	}
+}
+
+// closeAudioTracks force closes the audio tracks the session published
+func (h *MeetingHandler) closeAudioTracks(roomId string, session models.Session) {
+	if len(session.AudioMids) == 0 {
+		return
+	}
+	h.closeTracks(roomId, session.SessionID, func(mid string) bool {
+		return slices.Contains(session.AudioMids, mid)
+	})
+}
+
+// closeTracks force closes the session's open tracks whose mid is selected
+func (h *MeetingHandler) closeTracks(roomId, sessionID string, selected func(mid string) bool) {
+	logger := h.roomLogger(roomId).With("session_id", sessionID)
+	state, err := h.cloudflare.GetSessionState(context.Background(), sessionID)
+	if err != nil {
+		logger.Error("Error fetching session tracks", "error", err)
+		return
+	}
+
+	var tracks []services.CloseTrackObject
+	for _, track := range state.Tracks {
+		if track.Mid != "" && track.Status != "inactive" && selected(track.Mid) {
+			tracks = append(tracks, services.CloseTrackObject{Mid: track.Mid})
+		}
+	}
+	if len(tracks) == 0 {
+		return
+	}
+
+	_, err = h.cloudflare.CloseTracks(context.Background(), sessionID, &services.CloseTracksRequest{
+		Tracks: tracks,
+		Force:  true,
+	})
+	if err != nil {
+		logger.Error("Error closing session tracks", "error", err)
+	}
+}
+
+// EndMeeting disconnects everyone and closes their tracks, host only
+func (h *MeetingHandler) EndMeeting(c echo.Context) error {
+	claims := joinClaims(c)
+
+	if err := h.endMeeting(context.Background(), c.Param("roomId"), claims.SessionID); err != nil {
+		return c.JSON(moderationErrorStatus(err), map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// RunReaper periodically expires sessions that never got or lost their
+// WebSocket and archives meetings that stayed idle, until ctx is done
+func (h *MeetingHandler) RunReaper(ctx context.Context) {
+	if h.options.ReaperInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(h.options.ReaperInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.expireStaleSessions(ctx)
+			h.archiveIdleMeetings(ctx)
+		}
+	}
+}
+
+// expireStaleSessions removes sessions older than the grace period that no
+// instance saw a live WebSocket for within it. Each run first marks the
+// sessions this instance holds, screen share sessions have no socket of their
+// own and live as long as their owner's does. Lobby outcomes nobody collected
+// are dropped on the way.
+func (h *MeetingHandler) expireStaleSessions(ctx context.Context) {
+	meetings, err := h.store.ListActiveMeetings(ctx)
+	if err != nil {
+		h.logger.Error("Error listing active meetings", "error", err)
+		return
+	}
+
+	now := time.Now()
+	cutoff := now.Add(-h.options.SessionGracePeriod)
+	for _, meeting := range meetings {
+		connected := make(map[primitive.ObjectID]bool)
+		for _, rc := range h.hub.Connections(meeting.RoomID) {
+			connected[rc.UserID] = true
+		}
+
+		var seen []string
+		for _, session := range meeting.Sessions {
+			if connected[session.UserID] || h.resumes.parked(meeting.RoomID, session.SessionID) {
+				seen = append(seen, session.SessionID)
+			}
+		}
+		if err := h.store.TouchSessions(ctx, meeting.RoomID, seen, now); err != nil {
+			// Leave the room alone rather than expire sessions we hold
+			h.roomLogger(meeting.RoomID).Error("Error marking live sessions", "error", err)
+			continue
+		}
+		h.pruneLobby(ctx, &meeting, now)
+
+		for _, session := range meeting.Sessions {
+			if connected[session.UserID] || session.CreatedAt.After(cutoff) ||
+				session.LastSeenAt.After(cutoff) || h.resumes.parked(meeting.RoomID, session.SessionID) {
+				continue
+			}
+
+			removed, last, err := h.store.RemoveSession(ctx, meeting.RoomID, session.SessionID)
+			if err != nil {
+				// Most likely the participant left in the meantime
+				continue
+			}
+			h.roomLogger(meeting.RoomID).Info("Expired stale session",
+				"session_id", removed.SessionID,
+				"username", removed.Username,
+			)
+			h.recordAttendance(meeting.RoomID, removed, models.AttendanceLeave)
+
+			h.broadcastToRoom(meeting.RoomID, WebSocketMessage{
+				Type: "participant_left",
+				Payload: map[string]string{
+					"username":   removed.Username,
+					"session_id": removed.SessionID,
+				},
+			})
+			h.emitWebhook(meeting.RoomID, models.EventParticipantLeft, map[string]string{
+				"session_id": removed.SessionID,
+				"username":   removed.Username,
+				"reason":     "expired",
+			})
+			if last {
+				h.roomEmptied(meeting.RoomID)
+			}
+		}
+	}
+}
+
+// archiveIdleMeetings archives meetings without sessions that were not updated
+// within the idle TTL, unless a scheduled occurrence is still coming up
+func (h *MeetingHandler) archiveIdleMeetings(ctx context.Context) {
+	if h.options.MeetingIdleTTL <= 0 {
+		return
+	}
+
+	now := time.Now()
+	meetings, err := h.store.ListIdleMeetings(ctx, now.Add(-h.options.MeetingIdleTTL))
+	if err != nil {
+		h.logger.Error("Error listing idle meetings", "error", err)
+		return
+	}
+
+	for _, meeting := range meetings {
+		if meeting.Schedule != nil {
+			if _, upcoming := meeting.Schedule.Current(now); upcoming {
+				continue
+			}
+		}
+		if len(h.hub.Connections(meeting.RoomID)) > 0 {
+			continue
+		}
+
+		if err := h.store.ArchiveMeeting(ctx, meeting.RoomID); err != nil {
+			h.roomLogger(meeting.RoomID).Error("Error archiving meeting", "error", err)
+			continue
+		}
+		h.roomLogger(meeting.RoomID).Info("Archived idle meeting")
+	}
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"meeting-service/internal/models"
+	"meeting-service/internal/store"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// At most this many join requests wait in a meeting's lobby at a time
+const maxPendingLobbyEntries = 50
+
+// Resolved lobby entries are dropped by the reaper when the requester did
+// not collect the outcome within this long
+const lobbyOutcomeTTL = 10 * time.Minute
+
+// Pending lobby entries are dropped by the reaper when the requester stopped
+// polling for this long, so abandoned requests do not fill the lobby. Polls
+// are recorded at most once per lobbyPollTouchInterval.
+const (
+	lobbyPollTimeout       = 2 * time.Minute
+	lobbyPollTouchInterval = 30 * time.Second
+)
+
+// requestLobbyAdmission puts the user in the meeting's lobby and tells the
+// hosts. The caller polls GetLobbyStatus with the returned secret.
+func (h *MeetingHandler) requestLobbyAdmission(c echo.Context, meeting *models.Meeting, username string) error {
+	entry := models.LobbyEntry{
+		ID:          uuid.New().String(),
+		UserID:      primitive.NewObjectID(),
+		Username:    username,
+		Status:      models.LobbyPending,
+		PollSecret:  uuid.New().String(),
+		RequestedAt: time.Now(),
+	}
+	entry.LastPolledAt = entry.RequestedAt
+
+	err := h.store.AddLobbyEntry(c.Request().Context(), meeting.RoomID, entry, maxPendingLobbyEntries)
+	switch err {
+	case nil:
+	case store.ErrLobbyDuplicate:
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case store.ErrLobbyFull:
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update meeting"})
+	}
+
+	h.sendToModerators(meeting, WebSocketMessage{
+		Type: "lobby_request",
+		Payload: map[string]interface{}{
+			"request_id":   entry.ID,
+			"username":     entry.Username,
+			"requested_at": entry.RequestedAt,
+		},
+	})
+
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"status":      entry.Status,
+		"room_id":     meeting.RoomID,
+		"request_id":  entry.ID,
+		"poll_secret": entry.PollSecret,
+	})
+}
+
+// sendToModerators delivers a message only to the host and co-hosts,
+// wherever they are connected
+func (h *MeetingHandler) sendToModerators(meeting *models.Meeting, msg WebSocketMessage) {
+	var moderators []string
+	for _, session := range meeting.Sessions {
+		if meeting.IsModerator(session.UserID) {
+			moderators = append(moderators, session.SessionID)
+		}
+	}
+	h.hub.SendTo(meeting.RoomID, moderators, msg)
+}
+
+// resolveLobbyRequest admits or denies a pending lobby entry. Admitted users
+// get their Cloudflare session here, the token is handed out when they poll.
+func (h *MeetingHandler) resolveLobbyRequest(ctx context.Context, roomId, actorSessionID, requestID string, admit bool) error {
+	meeting, err := h.store.GetMeetingByRoom(ctx, roomId)
+	if err != nil {
+		return err
+	}
+
+	actor := meeting.FindSession(actorSessionID)
+	if actor == nil || !meeting.IsModerator(actor.UserID) {
+		return errNotModerator
+	}
+
+	entry := meeting.FindLobbyEntry(requestID)
+	if entry == nil {
+		return store.ErrLobbyNotFound
+	}
+	if entry.Status != models.LobbyPending {
+		return store.ErrLobbyResolved
+	}
+
+	resolvedAt := time.Now()
+	entry.ResolvedAt = &resolvedAt
+	var session *models.Session
+	if admit && !meeting.IsBanned(entry.Username) {
+		session, err = h.createParticipantSession(ctx, roomId, entry.UserID, entry.Username)
+		if err != nil {
+			return err
+		}
+		entry.Status = models.LobbyAdmitted
+		entry.SessionID = session.SessionID
+	} else {
+		entry.Status = models.LobbyDenied
+	}
+
+	// The update only goes through while the entry is pending, when another
+	// host resolved it first the session created here is taken back
+	if err := h.store.UpdateLobbyEntry(ctx, roomId, *entry); err != nil {
+		if session != nil {
+			if _, _, err := h.store.RemoveSession(ctx, roomId, session.SessionID); err == nil {
+				h.recordAttendance(roomId, session, models.AttendanceLeave)
+			}
+		}
+		return err
+	}
+
+	h.sendToModerators(meeting, WebSocketMessage{
+		Type: "lobby_resolved",
+		Payload: map[string]string{
+			"request_id": entry.ID,
+			"username":   entry.Username,
+			"status":     entry.Status,
+			"by":         actor.Username,
+		},
+	})
+	return nil
+}
+
+// pruneLobby drops the meeting's resolved entries that were never collected
+// and the pending ones nobody polls any more. The session of an admitted
+// entry is left to the reaper's grace period.
+func (h *MeetingHandler) pruneLobby(ctx context.Context, meeting *models.Meeting, now time.Time) {
+	resolvedBefore, abandonedBefore := now.Add(-lobbyOutcomeTTL), now.Add(-lobbyPollTimeout)
+	for _, entry := range meeting.Lobby {
+		if entry.Stale(resolvedBefore, abandonedBefore) {
+			if err := h.store.PruneLobby(ctx, meeting.RoomID, resolvedBefore, abandonedBefore); err != nil {
+				h.roomLogger(meeting.RoomID).Error("Error pruning lobby", "error", err)
+			}
+			return
+		}
+	}
+}
+
+func lobbyErrorStatus(err error) int {
+	switch err {
+	case errNotModerator:
+		return http.StatusForbidden
+	case store.ErrLobbyNotFound, store.ErrMeetingNotFound:
+		return http.StatusNotFound
+	case store.ErrLobbyResolved:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (h *MeetingHandler) handleLobbyDecision(c echo.Context, admit bool) error {
+	claims := joinClaims(c)
+
+	err := h.resolveLobbyRequest(context.Background(), c.Param("roomId"), claims.SessionID, c.Param("requestId"), admit)
+	if err != nil {
+		return c.JSON(lobbyErrorStatus(err), map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *MeetingHandler) AdmitLobbyRequest(c echo.Context) error {
+	return h.handleLobbyDecision(c, true)
+}
+
+func (h *MeetingHandler) DenyLobbyRequest(c echo.Context) error {
+	return h.handleLobbyDecision(c, false)
+}
+
+// GetLobbyStatus is polled by a waiting user. Once the request is resolved the
+// entry is removed and an admitted user receives the usual join response.
+func (h *MeetingHandler) GetLobbyStatus(c echo.Context) error {
+	roomId := c.Param("roomId")
+	requestID := c.Param("requestId")
+
+	meeting, err := h.store.GetMeetingByRoom(context.Background(), roomId)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Meeting not found"})
+	}
+
+	entry := meeting.FindLobbyEntry(requestID)
+	if entry == nil || subtle.ConstantTimeCompare([]byte(entry.PollSecret), []byte(c.QueryParam("secret"))) != 1 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Lobby request not found"})
+	}
+
+	switch entry.Status {
+	case models.LobbyPending:
+		if now := time.Now(); now.Sub(entry.LastPolledAt) >= lobbyPollTouchInterval {
+			if err := h.store.TouchLobbyEntry(context.Background(), roomId, requestID, now); err != nil {
+				h.roomLogger(roomId).Error("Error recording lobby poll", "error", err)
+			}
+		}
+		return c.JSON(http.StatusAccepted, map[string]string{"status": entry.Status})
+	case models.LobbyDenied:
+		h.store.RemoveLobbyEntry(context.Background(), roomId, requestID)
+		return c.JSON(http.StatusForbidden, map[string]string{"status": entry.Status, "error": "The host denied your request to join"})
+	}
+
+	if err := h.store.RemoveLobbyEntry(context.Background(), roomId, requestID); err != nil {
+		// Another poll already collected the admission
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Lobby request not found"})
+	}
+
+	session := meeting.FindSession(entry.SessionID)
+	if session == nil {
+		return c.JSON(http.StatusGone, map[string]string{"error": "Session is no longer part of the meeting"})
+	}
+	return h.joinResponse(c, roomId, session)
+}
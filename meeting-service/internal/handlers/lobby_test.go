@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"meeting-service/internal/broker"
+)
+
+type lobbyRequest struct {
+	RequestID  string `json:"request_id"`
+	PollSecret string `json:"poll_secret"`
+}
+
+// requestJoin asks to join a meeting with the lobby enabled and returns the status
+func requestJoin(t *testing.T, instance *testInstance, roomId, username string) (int, lobbyRequest) {
+	t.Helper()
+
+	resp, err := http.Get(instance.url + "/meetings/" + roomId + "?username=" + username)
+	if err != nil {
+		t.Fatalf("joining meeting: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var request lobbyRequest
+	json.NewDecoder(resp.Body).Decode(&request)
+	return resp.StatusCode, request
+}
+
+func TestLobbyDropsAbandonedRequests(t *testing.T) {
+	cluster := newTestCluster(t, broker.NewLocal())
+	instance := cluster.instances[0]
+
+	resp, err := http.Post(instance.url+"/meetings", "application/json",
+		bytes.NewBufferString(`{"title":"Standup","username":"alice","lobby_enabled":true}`))
+	if err != nil {
+		t.Fatalf("creating meeting: %v", err)
+	}
+	var created struct {
+		RoomID string `json:"room_id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	roomId := created.RoomID
+
+	var requests []lobbyRequest
+	for i := 0; i < maxPendingLobbyEntries; i++ {
+		status, request := requestJoin(t, instance, roomId, fmt.Sprintf("guest-%d", i))
+		if status != http.StatusAccepted {
+			t.Fatalf("lobby request %d: status %d, want %d", i, status, http.StatusAccepted)
+		}
+		requests = append(requests, request)
+	}
+	if status, _ := requestJoin(t, instance, roomId, "late"); status != http.StatusTooManyRequests {
+		t.Fatalf("request to a full lobby: status %d, want %d", status, http.StatusTooManyRequests)
+	}
+
+	// Only the first requester keeps polling
+	now := time.Now().Add(lobbyPollTimeout + time.Minute)
+	if err := cluster.meetings.TouchLobbyEntry(context.Background(), roomId, requests[0].RequestID, now); err != nil {
+		t.Fatalf("touching lobby entry: %v", err)
+	}
+
+	meeting, err := cluster.meetings.GetMeetingByRoom(context.Background(), roomId)
+	if err != nil {
+		t.Fatalf("loading meeting: %v", err)
+	}
+	instance.handler.pruneLobby(context.Background(), meeting, now)
+
+	meeting, _ = cluster.meetings.GetMeetingByRoom(context.Background(), roomId)
+	if len(meeting.Lobby) != 1 || meeting.Lobby[0].ID != requests[0].RequestID {
+		t.Fatalf("lobby keeps %d entries, want only the polled one", len(meeting.Lobby))
+	}
+
+	resp, err = http.Get(instance.url + "/meetings/" + roomId + "/lobby/" + requests[1].RequestID + "?secret=" + requests[1].PollSecret)
+	if err != nil {
+		t.Fatalf("polling lobby: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("polling a dropped request: status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+	if status, _ := requestJoin(t, instance, roomId, "late"); status != http.StatusAccepted {
+		t.Errorf("request after pruning: status %d, want %d", status, http.StatusAccepted)
+	}
+}
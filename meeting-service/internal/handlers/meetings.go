@@ -2,34 +2,116 @@ package handlers
 
 import (
 	"context"
-	"meeting-service/internal/database"
+	"errors"
+	"log/slog"
+	"meeting-service/internal/auth"
 	"meeting-service/internal/models"
 	"meeting-service/internal/services"
+	"meeting-service/internal/store"
 	"net/http"
+	"net/mail"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type MeetingHandler struct {
+	store      store.MeetingStore
+	chats      store.ChatStore
 	cloudflare *services.CloudflareService
+	tokens     *auth.TokenManager
+	hub        *Hub
+	attendance store.AttendanceStore
+	// speakingStats keeps the summaries the live speaking tracker produces
+	speakingStats store.SpeakingStore
+	speaking      *speakingTracker
+	webhooks      *services.WebhookService
+	watchers      *watcherRegistry
+	resumes       *resumeRegistry
+	drain         drainState
+	options       Options
+	logger        *slog.Logger
 }
 
-func NewMeetingHandler(cloudflare *services.CloudflareService) *MeetingHandler {
-	return &MeetingHandler{
-		cloudflare: cloudflare,
+// Options are the tunables of the meeting handler
+type Options struct {
+	// JoinWindow is how early and late a scheduled meeting may be joined
+	JoinWindow time.Duration
+	// FrontendURL is the base URL of the web app, used for join links. Invites
+	// carry no link when it is empty.
+	FrontendURL string
+	// SessionGracePeriod is how long a session may exist without a WebSocket
+	// before the reaper removes it
+	SessionGracePeriod time.Duration
+	// MeetingIdleTTL is how long a meeting without sessions is kept before it
+	// is archived, zero keeps meetings forever
+	MeetingIdleTTL time.Duration
+	// ReaperInterval is how often RunReaper runs, zero disables it
+	ReaperInterval time.Duration
+	// ResumeWindow is how long the session of a dropped WebSocket is kept for
+	// the client to resume it before the participant counts as left
+	ResumeWindow time.Duration
+	// Logger is used outside of requests, slog.Default() when nil
+	Logger *slog.Logger
+}
+
+func NewMeetingHandler(meetingStore store.MeetingStore, chatStore store.ChatStore, cloudflare *services.CloudflareService, tokens *auth.TokenManager, hub *Hub, attendance store.AttendanceStore, speakingStats store.SpeakingStore, webhooks *services.WebhookService, options Options) *MeetingHandler {
+	h := &MeetingHandler{
+		store:         meetingStore,
+		chats:         chatStore,
+		cloudflare:    cloudflare,
+		tokens:        tokens,
+		hub:           hub,
+		attendance:    attendance,
+		speakingStats: speakingStats,
+		speaking:      newSpeakingTracker(),
+		webhooks:      webhooks,
+		options:       options,
+		logger:        options.Logger,
+	}
+	if h.logger == nil {
+		h.logger = slog.Default()
 	}
+	h.watchers = newWatcherRegistry(meetingStore, h.sendRoomUpdate, h.logger)
+	h.resumes = newResumeRegistry(options.ResumeWindow)
+	hub.HandleNotice(noticeSpeaking, h.applySpeakingNotice)
+	hub.HandleNotice(noticeRoomClosed, h.forgetRoom)
+	hub.HandleNotice(noticeSessionClaimed, h.releaseClaimedSession)
+	return h
+}
+
+// roomLogger is the handler's logger for work outside of a request
+func (h *MeetingHandler) roomLogger(roomId string) *slog.Logger {
+	return h.logger.With("room_id", roomId)
 }
 
 type CreateMeetingRequest struct {
-	Title     string             `json:"title"`
-	CreatorID primitive.ObjectID `json:"creator_id"`
-	Username  string             `json:"username"`
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	CreatorID   primitive.ObjectID `json:"creator_id"`
+	Username    string             `json:"username"`
+	// CreatorEmail is optional, it names the organizer in calendar invites
+	CreatorEmail string `json:"creator_email"`
+	// LobbyEnabled makes joiners wait until a host admits them
+	LobbyEnabled bool `json:"lobby_enabled"`
+	// Passcode is optional, only its hash is stored
+	Passcode string `json:"passcode"`
+	// Schedule is optional, without it the meeting can be joined at any time
+	Schedule *models.Schedule `json:"schedule"`
+	// FeedToken proves a reused CreatorID belongs to the caller
+	FeedToken string `json:"feed_token"`
+}
+
+// CreateMeetingResponse is the meeting plus the creator's join token and the
+// feed token for their upcoming meetings and calendar
+type CreateMeetingResponse struct {
+	*models.Meeting
+	Token     string `json:"token"`
+	FeedToken string `json:"feed_token"`
 }
 
 func (h *MeetingHandler) CreateMeeting(c echo.Context) error {
@@ -38,17 +120,48 @@ func (h *MeetingHandler) CreateMeeting(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
+	if req.Schedule != nil {
+		if err := req.Schedule.Validate(); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+	if req.CreatorEmail != "" && !validEmail(req.CreatorEmail) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid creator_email"})
+	}
+
+	// The creator becomes the host, make sure they have an ID. Creator IDs are
+	// visible to participants, so one that already owns meetings may only be
+	// reused with its feed token.
+	if req.CreatorID.IsZero() {
+		req.CreatorID = primitive.NewObjectID()
+	} else if !h.tokens.VerifyFeedToken(req.FeedToken, req.CreatorID.Hex()) {
+		owned, err := h.store.ListMeetingsByCreator(context.Background(), req.CreatorID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check creator"})
+		}
+		if len(owned) > 0 {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "A feed token is required to reuse this creator_id"})
+		}
+	}
+
 	// Generate room ID
 	roomID := uuid.New().String()
 
 	// Create Cloudflare session
-	sessionID, err := h.cloudflare.CreateSession()
+	sessionID, err := h.cloudflare.CreateSession(c.Request().Context())
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create session"})
 	}
 
 	// Create meeting
-	meeting := models.NewMeeting(req.Title, "additionalString", req.CreatorID, roomID)
+	meeting := models.NewMeeting(req.Title, req.Description, req.CreatorID, roomID)
+	meeting.CreatorName = req.Username
+	meeting.CreatorEmail = req.CreatorEmail
+	meeting.LobbyEnabled = req.LobbyEnabled
+	meeting.Schedule = req.Schedule
+	if err := meeting.SetPasscode(req.Passcode); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to set passcode"})
+	}
 
 	// Add creator's session with username
 	meeting.Sessions = append(meeting.Sessions, models.Session{
@@ -58,14 +171,36 @@ func (h *MeetingHandler) CreateMeeting(c echo.Context) error {
 		CreatedAt: time.Now(),
 	})
 
-	// Save to MongoDB
-	collection := database.GetCollection("meetings")
-	_, err = collection.InsertOne(context.Background(), meeting)
+	token, err := h.tokens.Issue(roomID, sessionID, req.CreatorID.Hex(), req.Username)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to issue join token"})
+	}
+
+	// Save meeting
+	err = h.store.CreateMeeting(context.Background(), meeting)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save meeting"})
 	}
 
-	return c.JSON(http.StatusCreated, meeting)
+	h.recordAttendance(roomID, &meeting.Sessions[0], models.AttendanceJoin)
+	h.emitWebhook(roomID, models.EventMeetingCreated, map[string]interface{}{
+		"title":        meeting.Title,
+		"creator_id":   meeting.CreatorID.Hex(),
+		"creator_name": meeting.CreatorName,
+		"schedule":     meeting.Schedule,
+	})
+
+	return c.JSON(http.StatusCreated, CreateMeetingResponse{
+		Meeting:   meeting,
+		Token:     token,
+		FeedToken: h.tokens.FeedToken(req.CreatorID.Hex()),
+	})
+}
+
+// validEmail accepts a bare address, it ends up in the ORGANIZER of invites
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Name == "" && address.Address == email
 }
 
 type JoinMeetingRequest struct {
@@ -81,74 +216,162 @@ func (h *MeetingHandler) JoinMeeting(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Username is required"})
 	}
 
+	meeting, err := h.store.GetMeetingByRoom(c.Request().Context(), roomID)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Meeting not found"})
+	}
+	if h.meetingEnded(meeting, time.Now()) {
+		return c.JSON(http.StatusGone, map[string]string{"error": "Meeting has ended"})
+	}
+	if meeting.IsBanned(username) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "You are banned from this meeting"})
+	}
+
+	// A participant already in the meeting (e.g. adding a screen share session)
+	// presents their join token and skips the lock, passcode and lobby checks.
+	// The creator does the same with their feed token and rejoins as the host,
+	// e.g. after reloading the page or being expired by the reaper.
+	userID := primitive.NewObjectID()
+	if participant := h.participantFromToken(c, meeting); participant != nil {
+		userID = participant.UserID
+	} else if h.creatorFromFeedToken(c, meeting) {
+		userID = meeting.CreatorID
+	} else {
+		if next, ok := h.checkJoinWindow(meeting, time.Now()); !ok {
+			return scheduleErrorResponse(c, next)
+		}
+		if meeting.Locked {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Meeting is locked"})
+		}
+		if !meeting.CheckPasscode(c.QueryParam("passcode")) {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid passcode"})
+		}
+
+		// With the lobby enabled a host has to admit the user first
+		if meeting.LobbyEnabled {
+			return h.requestLobbyAdmission(c, meeting, username)
+		}
+	}
+
+	session, err := h.createParticipantSession(c.Request().Context(), roomID, userID, username)
+	if err == store.ErrMeetingNotFound {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Meeting not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return h.joinResponse(c, roomID, session)
+}
+
+// creatorFromFeedToken reports whether the request carries the feed token of
+// the meeting's creator in the feed_token query parameter
+func (h *MeetingHandler) creatorFromFeedToken(c echo.Context, meeting *models.Meeting) bool {
+	return h.tokens.VerifyFeedToken(c.QueryParam("feed_token"), meeting.CreatorID.Hex()) &&
+		!meeting.IsRevoked(meeting.CreatorID)
+}
+
+// createParticipantSession creates the Cloudflare session and adds it to the meeting
+func (h *MeetingHandler) createParticipantSession(ctx context.Context, roomID string, userID primitive.ObjectID, username string) (*models.Session, error) {
 	// Create new Cloudflare session
-	sessionID, err := h.cloudflare.CreateSession()
+	sessionID, err := h.cloudflare.CreateSession(ctx)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create session"})
+		return nil, errors.New("Failed to create session")
 	}
 
 	// Add session to meeting
-	collection := database.GetCollection("meetings")
 	session := models.Session{
-		UserID:    primitive.NewObjectID(), // Generate new ID for the user
+		UserID:    userID,
 		Username:  username,
 		SessionID: sessionID,
 		CreatedAt: time.Now(),
 	}
 
-	_, err = collection.UpdateOne(
-		context.Background(),
-		bson.M{"room_id": roomID},
-		bson.M{"$push": bson.M{"sessions": session}},
-	)
+	err = h.store.AddSession(ctx, roomID, session)
+	if err == store.ErrMeetingNotFound {
+		return nil, err
+	}
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update meeting"})
+		return nil, errors.New("Failed to update meeting")
+	}
+	h.recordAttendance(roomID, &session, models.AttendanceJoin)
+
+	return &session, nil
+}
+
+// joinResponse issues the join token for a session that is now part of the meeting
+func (h *MeetingHandler) joinResponse(c echo.Context, roomID string, session *models.Session) error {
+	token, err := h.tokens.Issue(roomID, session.SessionID, session.UserID.Hex(), session.Username)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to issue join token"})
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{
-		"session_id": sessionID,
-		"room_id":    roomID,
+		"session_id":     session.SessionID,
+		"room_id":        roomID,
+		"participant_id": session.UserID.Hex(),
+		"token":          token,
 	})
 }
 
+// MeetingPublicInfo is what /info shows to callers that are not in the meeting
+type MeetingPublicInfo struct {
+	RoomID       string           `json:"room_id"`
+	Title        string           `json:"title"`
+	Description  string           `json:"description"`
+	CreatorName  string           `json:"creator_name,omitempty"`
+	LobbyEnabled bool             `json:"lobby_enabled"`
+	HasPasscode  bool             `json:"has_passcode"`
+	Locked       bool             `json:"locked"`
+	Schedule     *models.Schedule `json:"schedule,omitempty"`
+	EndedAt      *time.Time       `json:"ended_at,omitempty"`
+}
+
+// GetMeetingInfo returns the full meeting to its participants, anyone else
+// only learns what they need to decide how to join
 func (h *MeetingHandler) GetMeetingInfo(c echo.Context) error {
 	roomID := c.Param("roomID")
 
-	collection := database.GetCollection("meetings")
-	var meeting models.Meeting
-	err := collection.FindOne(
-		context.Background(),
-		bson.M{"room_id": roomID},
-	).Decode(&meeting)
-
+	meeting, err := h.store.GetMeetingByRoom(context.Background(), roomID)
 	if err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Meeting not found"})
 	}
 
-	return c.JSON(http.StatusOK, meeting)
-}
+	if h.participantFromToken(c, meeting) != nil {
+		return c.JSON(http.StatusOK, meeting)
+	}
 
-func (h *MeetingHandler) GetCloudflareCredentials(c echo.Context) error {
-	return c.JSON(http.StatusOK, map[string]string{
-		"appId": h.cloudflare.AppID,
-		"token": h.cloudflare.AppToken,
+	return c.JSON(http.StatusOK, MeetingPublicInfo{
+		RoomID:       meeting.RoomID,
+		Title:        meeting.Title,
+		Description:  meeting.Description,
+		CreatorName:  meeting.CreatorName,
+		LobbyEnabled: meeting.LobbyEnabled,
+		HasPasscode:  meeting.PasscodeHash != "",
+		Locked:       meeting.Locked,
+		Schedule:     meeting.Schedule,
+		EndedAt:      meeting.EndedAt,
 	})
 }
 
 // Add new handler method
 func (h *MeetingHandler) NotifyTracksReady(c echo.Context) error {
 	roomId := c.Param("roomId")
+	claims := joinClaims(c)
 	var data struct {
 		SessionID string `json:"session_id"`
-		Username  string `json:"username"`
 	}
 
 	if err := c.Bind(&data); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
+	if data.SessionID != "" && data.SessionID != claims.SessionID {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Token does not match session"})
+	}
+
 	// Notify all participants in the room about the ready tracks
-	h.notifyTracksReady(roomId, data.SessionID, data.Username)
+	h.notifyTracksReady(roomId, claims.SessionID, claims.Username)
 
 	return c.NoContent(http.StatusOK)
 }
@@ -156,6 +379,7 @@ func (h *MeetingHandler) NotifyTracksReady(c echo.Context) error {
 // Add new handler method
 func (h *MeetingHandler) LeaveMeeting(c echo.Context) error {
 	roomId := c.Param("roomId")
+	claims := joinClaims(c)
 	var data struct {
 		SessionID string `json:"session_id"`
 	}
@@ -164,58 +388,41 @@ func (h *MeetingHandler) LeaveMeeting(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	// Remove session from MongoDB
-	collection := database.GetCollection("meetings")
-	result, err := collection.UpdateOne(
-		context.Background(),
-		bson.M{"room_id": roomId},
-		bson.M{
-			"$pull": bson.M{
-				"sessions": bson.M{
-					"session_id": data.SessionID,
-				},
-			},
-		},
-	)
-
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to update meeting",
-		})
+	if data.SessionID != "" && data.SessionID != claims.SessionID {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Token does not match session"})
 	}
 
-	if result.ModifiedCount == 0 {
+	// Remove session from the meeting
+	session, last, err := h.store.RemoveSession(context.Background(), roomId, claims.SessionID)
+	if err == store.ErrSessionNotFound {
 		return c.JSON(http.StatusNotFound, map[string]string{
 			"error": "Session not found",
 		})
 	}
-
-	// Fetch updated meeting info to broadcast
-	var meeting models.Meeting
-	err = collection.FindOne(context.Background(), bson.M{"room_id": roomId}).Decode(&meeting)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to fetch updated meeting info",
+			"error": "Failed to update meeting",
 		})
 	}
 
-	// Find username of the leaving session
-	var leavingUsername string
-	for _, session := range meeting.Sessions {
-		if session.SessionID == data.SessionID {
-			leavingUsername = session.Username
-			break
-		}
-	}
+	h.recordAttendance(roomId, session, models.AttendanceLeave)
 
 	// Notify other participants through WebSocket
 	h.broadcastToRoom(roomId, WebSocketMessage{
 		Type: "participant_left",
 		Payload: map[string]string{
-			"username":   leavingUsername,
-			"session_id": data.SessionID,
+			"username":   session.Username,
+			"session_id": claims.SessionID,
 		},
 	})
+	h.emitWebhook(roomId, models.EventParticipantLeft, map[string]string{
+		"session_id": claims.SessionID,
+		"username":   session.Username,
+		"reason":     "left",
+	})
+	if last {
+		h.roomEmptied(roomId)
+	}
 
 	return c.NoContent(http.StatusOK)
 }
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"meeting-service/internal/auth"
+	"meeting-service/internal/broker"
+)
+
+func TestCreatorRejoinsAsHost(t *testing.T) {
+	cluster := newTestCluster(t, broker.NewLocal())
+	instance := cluster.instances[0]
+	tokens := auth.NewTokenManager("test-secret", time.Hour)
+
+	resp, err := http.Post(instance.url+"/meetings", "application/json",
+		bytes.NewBufferString(`{"title":"Standup","username":"alice","passcode":"1234"}`))
+	if err != nil {
+		t.Fatalf("creating meeting: %v", err)
+	}
+	var created struct {
+		RoomID    string `json:"room_id"`
+		CreatorID string `json:"creator_id"`
+		FeedToken string `json:"feed_token"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+
+	// join joins and returns the participant the join token is for
+	join := func(query string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(instance.url + "/meetings/" + created.RoomID + "?username=alice" + query)
+		if err != nil {
+			t.Fatalf("joining meeting: %v", err)
+		}
+		defer resp.Body.Close()
+		var joined struct {
+			Token string `json:"token"`
+		}
+		json.NewDecoder(resp.Body).Decode(&joined)
+		if resp.StatusCode != http.StatusOK {
+			return resp.StatusCode, ""
+		}
+		claims, err := tokens.Verify(joined.Token, created.RoomID)
+		if err != nil {
+			t.Fatalf("verifying join token: %v", err)
+		}
+		return resp.StatusCode, claims.ParticipantID
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantHost   bool
+	}{
+		{"feed token skips the passcode", "&feed_token=" + created.FeedToken, http.StatusOK, true},
+		{"passcode joins as a participant", "&passcode=1234", http.StatusOK, false},
+		{"wrong feed token", "&feed_token=" + tokens.FeedToken(created.RoomID), http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, participant := join(tt.query)
+			if status != tt.wantStatus {
+				t.Fatalf("join status %d, want %d", status, tt.wantStatus)
+			}
+			if isHost := participant == created.CreatorID; isHost != tt.wantHost {
+				t.Errorf("joined as participant %s, host is %s", participant, created.CreatorID)
+			}
+		})
+	}
+}
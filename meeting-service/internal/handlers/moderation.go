@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"meeting-service/internal/models"
+	"meeting-service/internal/store"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Moderation actions, available over WebSocket as <action>_participant
+const (
+	actionMute    = "mute"
+	actionRemove  = "remove"
+	actionBan     = "ban"
+	actionPromote = "promote"
+)
+
+// Close code sent to participants removed by a moderator
+const closeRemovedByHost = 4001
+
+var (
+	errNotModerator      = errors.New("only the host or a co-host can do this")
+	errHostOnly          = errors.New("only the host can do this")
+	errCannotModerate    = errors.New("you cannot moderate this participant")
+	errParticipantAbsent = errors.New("participant not found")
+)
+
+// moderate checks the actor's role against the target's and applies the action
+func (h *MeetingHandler) moderate(ctx context.Context, roomId, actorSessionID, action, targetSessionID string) error {
+	meeting, err := h.store.GetMeetingByRoom(ctx, roomId)
+	if err != nil {
+		return err
+	}
+
+	actor := meeting.FindSession(actorSessionID)
+	if actor == nil {
+		return errNotModerator
+	}
+	target := meeting.FindSession(targetSessionID)
+	if target == nil {
+		return errParticipantAbsent
+	}
+
+	actorRole := meeting.RoleOf(actor.UserID)
+	targetRole := meeting.RoleOf(target.UserID)
+	if actorRole == models.RoleParticipant {
+		return errNotModerator
+	}
+	if action == actionPromote && actorRole != models.RoleHost {
+		return errHostOnly
+	}
+	// Nobody moderates the host and only the host moderates co-hosts
+	if actor.SessionID == target.SessionID || targetRole == models.RoleHost ||
+		(targetRole == models.RoleCoHost && actorRole != models.RoleHost) {
+		return errCannotModerate
+	}
+
+	event := map[string]string{
+		"session_id": target.SessionID,
+		"username":   target.Username,
+		"by":         actor.Username,
+	}
+
+	switch action {
+	case actionMute:
+		// The client is told to mute, closing its audio tracks enforces it
+		h.broadcastToRoom(roomId, WebSocketMessage{Type: "participant_muted", Payload: event})
+		go h.closeAudioTracks(roomId, *target)
+	case actionRemove:
+		return h.removeParticipant(ctx, roomId, target, event)
+	case actionBan:
+		if err := h.store.BanUsername(ctx, roomId, target.Username); err != nil {
+			return err
+		}
+		h.broadcastToRoom(roomId, WebSocketMessage{Type: "participant_banned", Payload: event})
+		return h.removeParticipant(ctx, roomId, target, event)
+	case actionPromote:
+		if err := h.store.AddCoHost(ctx, roomId, target.UserID); err != nil {
+			return err
+		}
+		h.broadcastToRoom(roomId, WebSocketMessage{Type: "participant_promoted", Payload: map[string]string{
+			"session_id": target.SessionID,
+			"username":   target.Username,
+			"by":         actor.Username,
+			"role":       models.RoleCoHost,
+		}})
+	default:
+		return errors.New("unknown moderation action")
+	}
+
+	return nil
+}
+
+// removeParticipant revokes the participant's join tokens, drops all of their
+// sessions, e.g. a screen share next to the camera, and disconnects them. The
+// regular leave path announces participant_left for sessions with a socket.
+func (h *MeetingHandler) removeParticipant(ctx context.Context, roomId string, target *models.Session, event map[string]string) error {
+	if err := h.store.RevokeParticipant(ctx, roomId, target.UserID); err != nil {
+		return err
+	}
+	// Read the sessions once no new one can be added with their tokens
+	meeting, err := h.store.GetMeetingByRoom(ctx, roomId)
+	if err != nil {
+		return err
+	}
+
+	var removed []models.Session
+	emptied := false
+	for _, session := range meeting.Sessions {
+		if session.UserID != target.UserID {
+			continue
+		}
+		_, last, err := h.store.RemoveSession(ctx, roomId, session.SessionID)
+		if err == store.ErrSessionNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		h.recordAttendance(roomId, &session, models.AttendanceLeave)
+		removed = append(removed, session)
+		emptied = emptied || last
+	}
+
+	// The sockets may be on any instance, they get the event before the close
+	h.broadcastToRoom(roomId, WebSocketMessage{Type: "participant_removed", Payload: event})
+	sessionIDs := []string{target.SessionID}
+	for _, session := range removed {
+		if session.SessionID == target.SessionID {
+			continue
+		}
+		sessionIDs = append(sessionIDs, session.SessionID)
+		h.broadcastToRoom(roomId, WebSocketMessage{
+			Type: "participant_left",
+			Payload: map[string]string{
+				"username":   session.Username,
+				"session_id": session.SessionID,
+			},
+		})
+	}
+	h.hub.Disconnect(roomId, sessionIDs, closeRemovedByHost, "removed by host")
+	if emptied {
+		h.roomEmptied(roomId)
+	}
+	return nil
+}
+
+func moderationErrorStatus(err error) int {
+	switch err {
+	case errNotModerator, errHostOnly, errCannotModerate:
+		return http.StatusForbidden
+	case errParticipantAbsent, store.ErrMeetingNotFound:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (h *MeetingHandler) handleModeration(c echo.Context, action string) error {
+	claims := joinClaims(c)
+
+	err := h.moderate(context.Background(), c.Param("roomId"), claims.SessionID, action, c.Param("sessionId"))
+	if err != nil {
+		return c.JSON(moderationErrorStatus(err), map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *MeetingHandler) MuteParticipant(c echo.Context) error {
+	return h.handleModeration(c, actionMute)
+}
+
+func (h *MeetingHandler) RemoveParticipant(c echo.Context) error {
+	return h.handleModeration(c, actionRemove)
+}
+
+func (h *MeetingHandler) BanParticipant(c echo.Context) error {
+	return h.handleModeration(c, actionBan)
+}
+
+func (h *MeetingHandler) PromoteParticipant(c echo.Context) error {
+	return h.handleModeration(c, actionPromote)
+}
+
+// setMeetingLock lets the host stop or allow new joins, current sessions stay
+func (h *MeetingHandler) setMeetingLock(ctx context.Context, roomId, actorSessionID string, locked bool) error {
+	meeting, err := h.store.GetMeetingByRoom(ctx, roomId)
+	if err != nil {
+		return err
+	}
+
+	actor := meeting.FindSession(actorSessionID)
+	if actor == nil || meeting.RoleOf(actor.UserID) != models.RoleHost {
+		return errHostOnly
+	}
+
+	if err := h.store.SetLocked(ctx, roomId, locked); err != nil {
+		return err
+	}
+
+	eventType := "meeting_unlocked"
+	if locked {
+		eventType = "meeting_locked"
+	}
+	h.broadcastToRoom(roomId, WebSocketMessage{
+		Type:    eventType,
+		Payload: map[string]string{"by": actor.Username},
+	})
+	return nil
+}
+
+func (h *MeetingHandler) handleLockChange(c echo.Context, locked bool) error {
+	claims := joinClaims(c)
+
+	if err := h.setMeetingLock(context.Background(), c.Param("roomId"), claims.SessionID, locked); err != nil {
+		return c.JSON(moderationErrorStatus(err), map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *MeetingHandler) LockMeeting(c echo.Context) error {
+	return h.handleLockChange(c, true)
+}
+
+func (h *MeetingHandler) UnlockMeeting(c echo.Context) error {
+	return h.handleLockChange(c, false)
+}
@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"meeting-service/internal/metrics"
+	"meeting-service/internal/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebSocket protocol versions the server speaks. Clients ask for the highest
+// version they support with ?protocol_version= and get the chosen one in hello.
+const (
+	ProtocolVersion    = 1
+	minProtocolVersion = 1
+)
+
+const (
+	// Largest frame a client may send, bigger ones close the connection
+	maxClientMessageSize = 64 << 10
+	// Longest chat message in characters
+	maxChatMessageLength = 4000
+	// Longest reaction in characters, enough for emoji with modifiers
+	maxReactionLength = 16
+)
+
+// Codes carried by error messages so clients can react without parsing text
+const (
+	ErrCodeInvalidJSON    = "invalid_json"
+	ErrCodeUnknownType    = "unknown_type"
+	ErrCodeInvalidPayload = "invalid_payload"
+	ErrCodeForbidden      = "forbidden"
+	ErrCodeNotFound       = "not_found"
+	ErrCodeConflict       = "conflict"
+	ErrCodeInternal       = "internal_error"
+)
+
+// HelloPayload is the first message on every connection. Seq is the room's
+// sequence so far and ResumeToken lets the client resume after a drop with
+// ?resume_token=&last_seq=. Resumed means the session continued without a
+// join, Replayed that the missed messages follow, otherwise room_state does.
+type HelloPayload struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	SessionID       string `json:"session_id"`
+	Username        string `json:"username"`
+	Seq             uint64 `json:"seq"`
+	ResumeToken     string `json:"resume_token"`
+	Resumed         bool   `json:"resumed"`
+	Replayed        bool   `json:"replayed"`
+	// ResumeRejected says why a resume token was not accepted, the session
+	// then continues from a fresh room_state
+	ResumeRejected string `json:"resume_rejected,omitempty"`
+}
+
+// ErrorPayload reports a client message the server rejected. Type and Ref
+// point back at that message, Ref is the id the client gave it if any.
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"`
+	Ref     string `json:"ref,omitempty"`
+}
+
+// clientEnvelope is a message as read from the socket, the payload is decoded
+// once its type is known
+type clientEnvelope struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// ClientMessage is the payload of a message type clients may send. Identity
+// fields are never read from it, the server stamps the connection's own.
+type ClientMessage interface {
+	Validate() error
+}
+
+type PingMessage struct{}
+
+type WaveMessage struct{}
+
+type SpeakingStateMessage struct {
+	IsSpeaking *bool `json:"isSpeaking"`
+}
+
+// ChatMessageMessage is a room chat line, ReplyTo makes it a thread reply
+type ChatMessageMessage struct {
+	Content string `json:"content"`
+	ReplyTo string `json:"reply_to"`
+}
+
+// ChatEditMessage replaces the content of the sender's own message
+type ChatEditMessage struct {
+	MessageID string `json:"message_id"`
+	Content   string `json:"content"`
+}
+
+// ChatDeleteMessage deletes a message, the author's own or any as the host
+type ChatDeleteMessage struct {
+	MessageID string `json:"message_id"`
+}
+
+// ChatReactMessage toggles the sender's reaction with the emoji
+type ChatReactMessage struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+// DirectMessageMessage is addressed to either a session or a participant,
+// the latter reaches all of the participant's sessions
+type DirectMessageMessage struct {
+	SessionID     string `json:"session_id"`
+	ParticipantID string `json:"participant_id"`
+	Content       string `json:"content"`
+}
+
+// ParticipantActionMessage targets a session for a moderation action
+type ParticipantActionMessage struct {
+	SessionID string `json:"session_id"`
+}
+
+type LobbyDecisionMessage struct {
+	RequestID string `json:"request_id"`
+}
+
+type MeetingLockMessage struct{}
+
+type EndMeetingMessage struct{}
+
+func (m *PingMessage) Validate() error        { return nil }
+func (m *WaveMessage) Validate() error        { return nil }
+func (m *MeetingLockMessage) Validate() error { return nil }
+func (m *EndMeetingMessage) Validate() error  { return nil }
+
+func (m *SpeakingStateMessage) Validate() error {
+	if m.IsSpeaking == nil {
+		return invalidPayload("isSpeaking is required")
+	}
+	return nil
+}
+
+func (m *ChatMessageMessage) Validate() error {
+	if m.ReplyTo != "" && !primitive.IsValidObjectID(m.ReplyTo) {
+		return invalidPayload("reply_to is not a valid message ID")
+	}
+	return validateChatContent(&m.Content)
+}
+
+func (m *ChatEditMessage) Validate() error {
+	if err := validateMessageID(m.MessageID); err != nil {
+		return err
+	}
+	return validateChatContent(&m.Content)
+}
+
+func (m *ChatDeleteMessage) Validate() error {
+	return validateMessageID(m.MessageID)
+}
+
+func (m *ChatReactMessage) Validate() error {
+	if err := validateMessageID(m.MessageID); err != nil {
+		return err
+	}
+	m.Emoji = strings.TrimSpace(m.Emoji)
+	if m.Emoji == "" || strings.ContainsAny(m.Emoji, " \t\n") {
+		return invalidPayload("emoji is required")
+	}
+	if utf8.RuneCountInString(m.Emoji) > maxReactionLength {
+		return invalidPayload("emoji is longer than %d characters", maxReactionLength)
+	}
+	return nil
+}
+
+func validateMessageID(id string) error {
+	if !primitive.IsValidObjectID(id) {
+		return invalidPayload("message_id is not a valid message ID")
+	}
+	return nil
+}
+
+func (m *DirectMessageMessage) Validate() error {
+	if (m.SessionID == "") == (m.ParticipantID == "") {
+		return invalidPayload("exactly one of session_id and participant_id is required")
+	}
+	return validateChatContent(&m.Content)
+}
+
+// validateChatContent trims the content and checks its length
+func validateChatContent(content *string) error {
+	*content = strings.TrimSpace(*content)
+	if *content == "" {
+		return invalidPayload("content is required")
+	}
+	if utf8.RuneCountInString(*content) > maxChatMessageLength {
+		return invalidPayload("content is longer than %d characters", maxChatMessageLength)
+	}
+	return nil
+}
+
+func (m *ParticipantActionMessage) Validate() error {
+	if m.SessionID == "" {
+		return invalidPayload("session_id is required")
+	}
+	return nil
+}
+
+func (m *LobbyDecisionMessage) Validate() error {
+	if m.RequestID == "" {
+		return invalidPayload("request_id is required")
+	}
+	return nil
+}
+
+// payloadError is a validation failure, its text is safe to show the client
+type payloadError struct {
+	message string
+}
+
+func (e *payloadError) Error() string {
+	return e.message
+}
+
+func invalidPayload(format string, args ...interface{}) error {
+	return &payloadError{message: fmt.Sprintf(format, args...)}
+}
+
+// messageSpec ties a message type to its payload struct and its handler
+type messageSpec struct {
+	payload func() ClientMessage
+	handle  func(h *MeetingHandler, roomId string, rc *RoomConnection, msg ClientMessage) error
+}
+
+// clientMessages is every message type clients may send
+var clientMessages = map[string]messageSpec{
+	"ping": {
+		payload: func() ClientMessage { return &PingMessage{} },
+		handle: func(h *MeetingHandler, roomId string, rc *RoomConnection, msg ClientMessage) error {
+			rc.Send(WebSocketMessage{Type: "pong"})
+			return nil
+		},
+	},
+	"wave": {
+		payload: func() ClientMessage { return &WaveMessage{} },
+		handle: func(h *MeetingHandler, roomId string, rc *RoomConnection, msg ClientMessage) error {
+			h.handleWave(roomId, rc)
+			return nil
+		},
+	},
+	"speaking_state": {
+		payload: func() ClientMessage { return &SpeakingStateMessage{} },
+		handle: func(h *MeetingHandler, roomId string, rc *RoomConnection, msg ClientMessage) error {
+			h.handleSpeakingState(roomId, rc, *msg.(*SpeakingStateMessage).IsSpeaking)
+			return nil
+		},
+	},
+	"chat_message": {
+		payload: func() ClientMessage { return &ChatMessageMessage{} },
+		handle: func(h *MeetingHandler, roomId string, rc *RoomConnection, msg ClientMessage) error {
+			return h.postChatMessage(roomId, rc, msg.(*ChatMessageMessage))
+		},
+	},
+	"chat_edit": {
+		payload: func() ClientMessage { return &ChatEditMessage{} },
+		handle: func(h *MeetingHandler, roomId string, rc *RoomConnection, msg ClientMessage) error {
+			return h.editChatMessage(roomId, rc, msg.(*ChatEditMessage))
+		},
+	},
+	"chat_delete": {
+		payload: func() ClientMessage { return &ChatDeleteMessage{} },
+		handle: func(h *MeetingHandler, roomId string, rc *RoomConnection, msg ClientMessage) error {
+			return h.deleteChatMessage(roomId, rc, msg.(*ChatDeleteMessage))
+		},
+	},
+	"chat_react": {
+		payload: func() ClientMessage { return &ChatReactMessage{} },
+		handle: func(h *MeetingHandler, roomId string, rc *RoomConnection, msg ClientMessage) error {
+			return h.reactToChatMessage(roomId, rc, msg.(*ChatReactMessage))
+		},
+	},
+	"direct_message": {
+		payload: func() ClientMessage { return &DirectMessageMessage{} },
+		handle: func(h *MeetingHandler, roomId string, rc *RoomConnection, msg ClientMessage) error {
+			return h.postDirectMessage(roomId, rc, msg.(*DirectMessageMessage))
+		},
+	},
+	"mute_participant":    moderationMessage(actionMute),
+	"remove_participant":  moderationMessage(actionRemove),
+	"ban_participant":     moderationMessage(actionBan),
+	"promote_participant": moderationMessage(actionPromote),
+	"admit_participant":   lobbyMessage(true),
+	"deny_participant":    lobbyMessage(false),
+	"lock_meeting":        lockMessage(true),
+	"unlock_meeting":      lockMessage(false),
+	"end_meeting": {
+		payload: func() ClientMessage { return &EndMeetingMessage{} },
+		handle: func(h *MeetingHandler, roomId string, rc *RoomConnection, msg ClientMessage) error {
+			return h.endMeeting(context.Background(), roomId, rc.SessionID)
+		},
+	},
+}
+
+func moderationMessage(action string) messageSpec {
+	return messageSpec{
+		payload: func() ClientMessage { return &ParticipantActionMessage{} },
+		handle: func(h *MeetingHandler, roomId string, rc *RoomConnection, msg ClientMessage) error {
+			target := msg.(*ParticipantActionMessage).SessionID
+			return h.moderate(context.Background(), roomId, rc.SessionID, action, target)
+		},
+	}
+}
+
+func lobbyMessage(admit bool) messageSpec {
+	return messageSpec{
+		payload: func() ClientMessage { return &LobbyDecisionMessage{} },
+		handle: func(h *MeetingHandler, roomId string, rc *RoomConnection, msg ClientMessage) error {
+			requestID := msg.(*LobbyDecisionMessage).RequestID
+			return h.resolveLobbyRequest(context.Background(), roomId, rc.SessionID, requestID, admit)
+		},
+	}
+}
+
+func lockMessage(locked bool) messageSpec {
+	return messageSpec{
+		payload: func() ClientMessage { return &MeetingLockMessage{} },
+		handle: func(h *MeetingHandler, roomId string, rc *RoomConnection, msg ClientMessage) error {
+			return h.setMeetingLock(context.Background(), roomId, rc.SessionID, locked)
+		},
+	}
+}
+
+// negotiateProtocol picks the version for a client asking for requested.
+// Clients that don't ask are treated as speaking the current version.
+func negotiateProtocol(requested string) (int, error) {
+	if requested == "" {
+		return ProtocolVersion, nil
+	}
+	version, err := strconv.Atoi(requested)
+	if err != nil || version < minProtocolVersion {
+		return 0, fmt.Errorf("unsupported protocol version %q, this server speaks %d to %d",
+			requested, minProtocolVersion, ProtocolVersion)
+	}
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+	return version, nil
+}
+
+// handleClientMessage decodes, validates and dispatches one message. Failures
+// are answered with an error message to the sender only.
+func (h *MeetingHandler) handleClientMessage(roomId string, rc *RoomConnection, data []byte) {
+	var envelope clientEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		metrics.WSMessageReceived("unknown")
+		rc.sendError(envelope, ErrCodeInvalidJSON, "Message is not valid JSON")
+		return
+	}
+
+	spec, ok := clientMessages[envelope.Type]
+	if !ok {
+		// Client supplied types are only used as a label when we know them
+		metrics.WSMessageReceived("unknown")
+		rc.sendError(envelope, ErrCodeUnknownType, fmt.Sprintf("Unknown message type %q", envelope.Type))
+		return
+	}
+	metrics.WSMessageReceived(envelope.Type)
+
+	msg := spec.payload()
+	if payload := bytes.TrimSpace(envelope.Payload); len(payload) > 0 && !bytes.Equal(payload, []byte("null")) {
+		if err := json.Unmarshal(payload, msg); err != nil {
+			rc.sendError(envelope, ErrCodeInvalidPayload, fmt.Sprintf("Invalid %s payload", envelope.Type))
+			return
+		}
+	}
+
+	err := msg.Validate()
+	if err == nil {
+		err = spec.handle(h, roomId, rc, msg)
+	}
+	if err != nil {
+		code := protocolErrorCode(err)
+		message := err.Error()
+		if code == ErrCodeInternal {
+			rc.log.Error("Error handling message", "type", envelope.Type, "error", err)
+			message = "Something went wrong, please try again"
+		}
+		rc.sendError(envelope, code, message)
+	}
+}
+
+// protocolErrorCode is the WebSocket counterpart of the HTTP status mappings
+func protocolErrorCode(err error) string {
+	var invalid *payloadError
+	if errors.As(err, &invalid) {
+		return ErrCodeInvalidPayload
+	}
+	switch err {
+	case errNotModerator, errHostOnly, errCannotModerate, errNotChatAuthor, errCannotDeleteChat:
+		return ErrCodeForbidden
+	case errParticipantAbsent, errRecipientAbsent, store.ErrMeetingNotFound, store.ErrLobbyNotFound,
+		store.ErrSessionNotFound, store.ErrChatNotFound:
+		return ErrCodeNotFound
+	case store.ErrLobbyResolved, errChatDeleted, store.ErrChatConflict:
+		return ErrCodeConflict
+	default:
+		return ErrCodeInternal
+	}
+}
+
+func (rc *RoomConnection) sendError(envelope clientEnvelope, code, message string) {
+	rc.Send(WebSocketMessage{
+		Type: "error",
+		Payload: ErrorPayload{
+			Code:    code,
+			Message: message,
+			Type:    envelope.Type,
+			Ref:     envelope.ID,
+		},
+	})
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"meeting-service/internal/broker"
+
+	"github.com/gorilla/websocket"
+)
+
+// expectError reads until an error message arrives and returns its payload
+func expectError(t *testing.T, p *testParticipant) ErrorPayload {
+	t.Helper()
+
+	var msg struct {
+		Payload ErrorPayload `json:"payload"`
+	}
+	expect(t, p.conn, "error", &msg)
+	return msg.Payload
+}
+
+func TestClientMessageErrors(t *testing.T) {
+	cluster := newTestCluster(t, broker.NewLocal())
+	instance := cluster.instances[0]
+
+	roomId, alice := cluster.createMeeting(t, instance)
+	bob := cluster.join(t, instance, roomId, "bob")
+
+	longContent := strings.Repeat("a", maxChatMessageLength+1)
+	tests := []struct {
+		name     string
+		sender   *testParticipant
+		frame    string
+		wantCode string
+		wantType string
+	}{
+		{"not json", alice, `{"type":`, ErrCodeInvalidJSON, ""},
+		{"unknown type", alice, `{"type":"shout","id":"1"}`, ErrCodeUnknownType, "shout"},
+		{"payload of the wrong shape", alice, `{"type":"speaking_state","id":"1","payload":"yes"}`, ErrCodeInvalidPayload, "speaking_state"},
+		{"missing field", alice, `{"type":"speaking_state","id":"1","payload":{}}`, ErrCodeInvalidPayload, "speaking_state"},
+		{"blank chat message", alice, `{"type":"chat_message","id":"1","payload":{"content":"  "}}`, ErrCodeInvalidPayload, "chat_message"},
+		{"chat message too long", alice, `{"type":"chat_message","id":"1","payload":{"content":"` + longContent + `"}}`, ErrCodeInvalidPayload, "chat_message"},
+		{"reply to an invalid ID", alice, `{"type":"chat_message","id":"1","payload":{"content":"hi","reply_to":"nope"}}`, ErrCodeInvalidPayload, "chat_message"},
+		{"edit of an invalid ID", alice, `{"type":"chat_edit","id":"1","payload":{"message_id":"nope","content":"hi"}}`, ErrCodeInvalidPayload, "chat_edit"},
+		{"reaction with spaces", alice, `{"type":"chat_react","id":"1","payload":{"message_id":"000000000000000000000000","emoji":"a b"}}`, ErrCodeInvalidPayload, "chat_react"},
+		{"direct message to both", alice, `{"type":"direct_message","id":"1","payload":{"session_id":"s","participant_id":"p","content":"hi"}}`, ErrCodeInvalidPayload, "direct_message"},
+		{"unknown chat message", alice, `{"type":"chat_delete","id":"1","payload":{"message_id":"000000000000000000000000"}}`, ErrCodeNotFound, "chat_delete"},
+		{"unknown lobby request", alice, `{"type":"admit_participant","id":"1","payload":{"request_id":"nope"}}`, ErrCodeNotFound, "admit_participant"},
+		{"moderation by a participant", bob, `{"type":"mute_participant","id":"1","payload":{"session_id":"` + alice.sessionID + `"}}`, ErrCodeForbidden, "mute_participant"},
+		{"lock by a participant", bob, `{"type":"lock_meeting","id":"1"}`, ErrCodeForbidden, "lock_meeting"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sender.conn.WriteMessage(websocket.TextMessage, []byte(tt.frame)); err != nil {
+				t.Fatalf("sending message: %v", err)
+			}
+			got := expectError(t, tt.sender)
+			if got.Code != tt.wantCode {
+				t.Errorf("error code %q (%s), want %q", got.Code, got.Message, tt.wantCode)
+			}
+			if got.Type != tt.wantType {
+				t.Errorf("error type %q, want %q", got.Type, tt.wantType)
+			}
+			// Only a frame that could be decoded can be referred back to
+			wantRef := "1"
+			if tt.wantCode == ErrCodeInvalidJSON {
+				wantRef = ""
+			}
+			if got.Ref != wantRef {
+				t.Errorf("error ref %q, want %q", got.Ref, wantRef)
+			}
+		})
+	}
+
+	// The connection stays usable after rejected messages
+	if err := alice.conn.WriteJSON(map[string]string{"type": "ping"}); err != nil {
+		t.Fatalf("sending ping: %v", err)
+	}
+	expect(t, alice.conn, "pong", nil)
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Close code sent to a connection whose session was resumed on a newer one
+const closeSuperseded = 4003
+
+var (
+	errResumeRejected = errors.New("resume token is unknown or expired")
+	// Sequence numbers and replay buffers are kept per instance, resuming
+	// needs the load balancer to send the client back to the same one
+	errResumeElsewhere = errors.New("resume token was issued by another instance")
+)
+
+// noticeSessionClaimed tells the other instances that a new connection took
+// over a session, they drop what they still hold of it
+const noticeSessionClaimed = "session_claimed"
+
+type sessionClaim struct {
+	SessionID string `json:"session_id"`
+	Instance  string `json:"instance"`
+}
+
+// What happened to a session when its socket went away
+type detachResult int
+
+const (
+	// The session left the room
+	sessionLeft detachResult = iota
+	// The session is kept for the resume window
+	sessionParked
+	// A newer connection already resumed the session
+	sessionSuperseded
+)
+
+// resumeRegistry hands every connection a resume token and keeps the session
+// of a dropped connection for the resume window, so a client that reconnects
+// in time continues where it was instead of leaving and joining again
+type resumeRegistry struct {
+	mu     sync.Mutex
+	window time.Duration
+	// instance prefixes the tokens, it tells tokens of other instances apart
+	instance string
+	byToken  map[string]*resumeEntry
+}
+
+type resumeEntry struct {
+	roomId string
+	rc     *RoomConnection
+	// expiry is set while the connection is down
+	expiry *time.Timer
+}
+
+func newResumeRegistry(window time.Duration) *resumeRegistry {
+	return &resumeRegistry{
+		window:   window,
+		instance: uuid.New().String(),
+		byToken:  make(map[string]*resumeEntry),
+	}
+}
+
+// issue gives the connection a fresh resume token
+func (r *resumeRegistry) issue(roomId string, rc *RoomConnection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rc.resumeToken = r.instance + "." + uuid.New().String()
+	r.byToken[rc.resumeToken] = &resumeEntry{roomId: roomId, rc: rc}
+}
+
+// resume claims the session behind the token. The token is single use, the
+// new connection gets its own. It returns the previous connection when that
+// one is still registered, the caller closes it.
+func (r *resumeRegistry) resume(token, roomId, sessionID string) (*RoomConnection, error) {
+	if !strings.HasPrefix(token, r.instance+".") {
+		return nil, errResumeElsewhere
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry := r.byToken[token]
+	if entry == nil || entry.roomId != roomId || entry.rc.SessionID != sessionID {
+		return nil, errResumeRejected
+	}
+	if entry.expiry != nil {
+		// The window ran out, the expiry is already removing the session
+		if !entry.expiry.Stop() {
+			return nil, errResumeRejected
+		}
+		delete(r.byToken, token)
+		return nil, nil
+	}
+
+	// The client noticed the drop before we did
+	delete(r.byToken, token)
+	entry.rc.superseded = true
+	return entry.rc, nil
+}
+
+// supersede drops every other entry of the session before a new connection
+// registers for it, e.g. after a page reload without a resume token or after
+// a rejected resume. A parked entry must not expire and take the live session
+// out of the room, a connection that is still registered is returned for the
+// caller to close.
+func (r *resumeRegistry) supersede(roomId, sessionID string) []*RoomConnection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var live []*RoomConnection
+	for token, entry := range r.byToken {
+		if entry.roomId != roomId || entry.rc.SessionID != sessionID {
+			continue
+		}
+		// Once the entry is gone a firing expiry finds nothing to do
+		delete(r.byToken, token)
+		if entry.expiry != nil {
+			entry.expiry.Stop()
+			continue
+		}
+		entry.rc.superseded = true
+		live = append(live, entry.rc)
+	}
+	return live
+}
+
+// claimSession tells the other instances that this one now serves the session
+func (h *MeetingHandler) claimSession(roomId, sessionID string) {
+	h.hub.Notify(roomId, noticeSessionClaimed, sessionClaim{SessionID: sessionID, Instance: h.resumes.instance})
+}
+
+// releaseClaimedSession drops this instance's hold on a session that another
+// instance took over. A parked entry would otherwise expire and take the live
+// session out of the room.
+func (h *MeetingHandler) releaseClaimedSession(roomId string, payload json.RawMessage) {
+	var claim sessionClaim
+	if err := json.Unmarshal(payload, &claim); err != nil {
+		h.roomLogger(roomId).Error("Error decoding session claim", "error", err)
+		return
+	}
+	if claim.Instance == h.resumes.instance {
+		return
+	}
+	for _, previous := range h.resumes.supersede(roomId, claim.SessionID) {
+		previous.CloseWithReason(closeSuperseded, "session continued on another instance")
+	}
+}
+
+// detach is called once the connection's socket is gone. With park set the
+// session is kept for the resume window and expire runs when it was not
+// resumed in time.
+func (r *resumeRegistry) detach(rc *RoomConnection, park bool, expire func()) detachResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if rc.superseded {
+		return sessionSuperseded
+	}
+	entry := r.byToken[rc.resumeToken]
+	if entry == nil {
+		return sessionLeft
+	}
+	if !park {
+		delete(r.byToken, rc.resumeToken)
+		return sessionLeft
+	}
+
+	token := rc.resumeToken
+	entry.expiry = time.AfterFunc(r.window, func() {
+		r.mu.Lock()
+		current := r.byToken[token]
+		if current == entry {
+			delete(r.byToken, token)
+		}
+		r.mu.Unlock()
+
+		if current == entry {
+			expire()
+		}
+	})
+	return sessionParked
+}
+
+// forget drops the token of a connection that never made it into its room
+func (r *resumeRegistry) forget(rc *RoomConnection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.byToken, rc.resumeToken)
+}
+
+// parked reports whether the session is waiting to be resumed, an empty
+// sessionID matches any session of the room
+func (r *resumeRegistry) parked(roomId, sessionID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range r.byToken {
+		if entry.expiry != nil && entry.roomId == roomId &&
+			(sessionID == "" || entry.rc.SessionID == sessionID) {
+			return true
+		}
+	}
+	return false
+}
+
+// stopAll cancels every pending expiry on shutdown, the sessions are kept for
+// clients reconnecting to another instance
+func (r *resumeRegistry) stopAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for token, entry := range r.byToken {
+		if entry.expiry != nil {
+			entry.expiry.Stop()
+		}
+		delete(r.byToken, token)
+	}
+}
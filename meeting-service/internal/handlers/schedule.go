@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"meeting-service/internal/models"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultOccurrenceLimit = 10
+	maxOccurrenceLimit     = 100
+)
+
+// UpcomingOccurrence is one occurrence of one of a user's meetings
+type UpcomingOccurrence struct {
+	RoomID    string    `json:"room_id"`
+	Title     string    `json:"title"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// checkJoinWindow returns the next occurrence when a scheduled meeting can not
+// be joined at now. Joins are allowed from JoinWindow before an occurrence
+// starts until JoinWindow after it ends.
+func (h *MeetingHandler) checkJoinWindow(meeting *models.Meeting, now time.Time) (*models.Occurrence, bool) {
+	if meeting.Schedule == nil {
+		return nil, true
+	}
+	occurrence, ok := meeting.Schedule.Current(now.Add(-h.options.JoinWindow))
+	if !ok {
+		return nil, false
+	}
+	if now.Before(occurrence.StartTime.Add(-h.options.JoinWindow)) {
+		return &occurrence, false
+	}
+	return &occurrence, true
+}
+
+func scheduleErrorResponse(c echo.Context, next *models.Occurrence) error {
+	if next == nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Meeting has no upcoming occurrences"})
+	}
+	return c.JSON(http.StatusForbidden, map[string]interface{}{
+		"error":     "Meeting has not started yet",
+		"starts_at": next.StartTime,
+	})
+}
+
+// occurrenceQuery reads the optional from (RFC 3339) and limit query parameters
+func occurrenceQuery(c echo.Context) (time.Time, int, error) {
+	from := time.Now()
+	if value := c.QueryParam("from"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid from time")
+		}
+		from = t
+	}
+
+	limit := defaultOccurrenceLimit
+	if value := c.QueryParam("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return from, 0, echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+		}
+		limit = n
+	}
+	if limit > maxOccurrenceLimit {
+		limit = maxOccurrenceLimit
+	}
+	return from, limit, nil
+}
+
+// GetOccurrences lists the upcoming occurrences of a scheduled meeting
+func (h *MeetingHandler) GetOccurrences(c echo.Context) error {
+	roomId := c.Param("roomId")
+
+	from, limit, err := occurrenceQuery(c)
+	if err != nil {
+		return authorizationErrorResponse(c, err)
+	}
+
+	meeting, err := h.store.GetMeetingByRoom(context.Background(), roomId)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Meeting not found"})
+	}
+
+	occurrences := []models.Occurrence{}
+	if meeting.Schedule != nil {
+		occurrences = meeting.Schedule.Occurrences(from, limit)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"room_id":     roomId,
+		"schedule":    meeting.Schedule,
+		"occurrences": occurrences,
+	})
+}
+
+// GetUpcomingMeetings lists the next occurrences across all scheduled meetings
+// created by a user
+func (h *MeetingHandler) GetUpcomingMeetings(c echo.Context) error {
+	creatorID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	from, limit, err := occurrenceQuery(c)
+	if err != nil {
+		return authorizationErrorResponse(c, err)
+	}
+
+	meetings, err := h.store.ListMeetingsByCreator(context.Background(), creatorID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list meetings"})
+	}
+
+	upcoming := []UpcomingOccurrence{}
+	for _, meeting := range meetings {
+		if meeting.Schedule == nil {
+			continue
+		}
+		for _, occurrence := range meeting.Schedule.Occurrences(from, limit) {
+			upcoming = append(upcoming, UpcomingOccurrence{
+				RoomID:    meeting.RoomID,
+				Title:     meeting.Title,
+				StartTime: occurrence.StartTime,
+				EndTime:   occurrence.EndTime,
+			})
+		}
+	}
+
+	sort.Slice(upcoming, func(i, j int) bool {
+		return upcoming[i].StartTime.Before(upcoming[j].StartTime)
+	})
+	if len(upcoming) > limit {
+		upcoming = upcoming[:limit]
+	}
+
+	return c.JSON(http.StatusOK, upcoming)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// Clients are told to reconnect after the minimum plus a random jitter so
+	// they do not all hit the remaining instances at once
+	shutdownReconnectMin    = time.Second
+	shutdownReconnectJitter = 4 * time.Second
+)
+
+// ServerShutdownPayload tells clients the socket is about to close and when
+// to reconnect, their session is kept for the reconnect
+type ServerShutdownPayload struct {
+	Reconnect    bool  `json:"reconnect"`
+	RetryAfterMs int64 `json:"retry_after_ms"`
+}
+
+// drainState stops new joins once shutdown started and counts the read loops
+// Shutdown waits for
+type drainState struct {
+	mu       sync.RWMutex
+	draining bool
+	sockets  sync.WaitGroup
+}
+
+func (h *MeetingHandler) isDraining() bool {
+	h.drain.mu.RLock()
+	defer h.drain.mu.RUnlock()
+	return h.drain.draining
+}
+
+// registerSocket adds the connection to its room and counts its read loop,
+// it fails once the server is draining. Holding the lock across both makes
+// sure Shutdown sees every connection it has to wait for.
+func (h *MeetingHandler) registerSocket(roomId string, rc *RoomConnection, resumeAfter *uint64, hello func(seq uint64, replayed bool) WebSocketMessage) (replayed, ok bool) {
+	h.drain.mu.RLock()
+	defer h.drain.mu.RUnlock()
+
+	if h.drain.draining {
+		return false, false
+	}
+	h.drain.sockets.Add(1)
+	return h.hub.Register(roomId, rc, resumeAfter, hello), true
+}
+
+// RejectWhileDraining turns new meetings and joins away once shutdown started,
+// clients retry and land on another instance
+func (h *MeetingHandler) RejectWhileDraining(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if h.isDraining() {
+			return drainingResponse(c)
+		}
+		return next(c)
+	}
+}
+
+func drainingResponse(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderRetryAfter, "5")
+	return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Server is shutting down"})
+}
+
+// Shutdown stops new joins, asks every connected client to reconnect and
+// closes the sockets. It waits for the read loops to finish and then closes
+// the change streams, giving up when ctx is done.
+func (h *MeetingHandler) Shutdown(ctx context.Context) error {
+	h.drain.mu.Lock()
+	h.drain.draining = true
+	h.drain.mu.Unlock()
+	h.resumes.stopAll()
+
+	conns := h.hub.All()
+	h.logger.Info("Draining WebSocket connections", "connections", len(conns))
+	for _, rc := range conns {
+		retryAfter := shutdownReconnectMin + time.Duration(rand.Int63n(int64(shutdownReconnectJitter)))
+		// The writer flushes the event before the close frame
+		rc.Send(WebSocketMessage{
+			Type: "server_shutdown",
+			Payload: ServerShutdownPayload{
+				Reconnect:    true,
+				RetryAfterMs: retryAfter.Milliseconds(),
+			},
+		})
+		rc.CloseWithReason(websocket.CloseServiceRestart, "server shutdown")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.drain.sockets.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		h.logger.Warn("Gave up waiting for WebSocket connections", "error", ctx.Err())
+	}
+
+	return h.watchers.stopAll(ctx)
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"meeting-service/internal/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Live speaking_stats go out at most this often per room
+const speakingStatsInterval = 2 * time.Second
+
+// noticeSpeaking carries a speaking state change to the tracker of every
+// instance, so they all count the same stretches and report the same stats
+const noticeSpeaking = "speaking_update"
+
+type speakingNotice struct {
+	SessionID string    `json:"session_id"`
+	Username  string    `json:"username"`
+	Speaking  bool      `json:"speaking"`
+	At        time.Time `json:"at"`
+}
+
+// speakingTracker aggregates the speaking_state events of every active room
+type speakingTracker struct {
+	mu    sync.Mutex
+	rooms map[string]*roomSpeaking
+}
+
+type roomSpeaking struct {
+	startedAt time.Time
+	speakers  map[string]*speakerState
+	// order keeps the stats in the order participants first spoke
+	order []string
+	// lastSent and pending throttle the live broadcast
+	lastSent time.Time
+	pending  bool
+}
+
+type speakerState struct {
+	username      string
+	talk          time.Duration
+	longest       time.Duration
+	interruptions int
+	interrupted   int
+	// since is when the current stretch started, zero while silent
+	since time.Time
+}
+
+func newSpeakingTracker() *speakingTracker {
+	return &speakingTracker{rooms: make(map[string]*roomSpeaking)}
+}
+
+func (t *speakingTracker) room(roomId string, now time.Time) *roomSpeaking {
+	room := t.rooms[roomId]
+	if room == nil {
+		room = &roomSpeaking{startedAt: now, speakers: make(map[string]*speakerState)}
+		t.rooms[roomId] = room
+	}
+	return room
+}
+
+// update applies a speaking state change and reports whether anything changed.
+// Starting while someone else speaks counts as interrupting everyone speaking.
+func (t *speakingTracker) update(roomId, sessionID, username string, speaking bool, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !speaking && t.rooms[roomId] == nil {
+		return false
+	}
+	room := t.room(roomId, now)
+	speaker := room.speakers[sessionID]
+	if speaker == nil {
+		if !speaking {
+			return false
+		}
+		speaker = &speakerState{username: username}
+		room.speakers[sessionID] = speaker
+		room.order = append(room.order, sessionID)
+	}
+
+	if !speaking {
+		return speaker.stop(now)
+	}
+	if !speaker.since.IsZero() {
+		return false
+	}
+
+	for id, other := range room.speakers {
+		if id != sessionID && !other.since.IsZero() {
+			other.interrupted++
+			speaker.interruptions++
+		}
+	}
+	speaker.since = now
+	return true
+}
+
+func (s *speakerState) stop(now time.Time) bool {
+	if s.since.IsZero() {
+		return false
+	}
+	// The change may come from an instance whose clock is a little behind
+	stretch := now.Sub(s.since)
+	if stretch < 0 {
+		stretch = 0
+	}
+	s.talk += stretch
+	if stretch > s.longest {
+		s.longest = stretch
+	}
+	s.since = time.Time{}
+	return true
+}
+
+// stats returns the room's stats, counting stretches still in progress
+func (room *roomSpeaking) stats(now time.Time) []models.SpeakerStats {
+	stats := make([]models.SpeakerStats, 0, len(room.order))
+	for _, sessionID := range room.order {
+		speaker := room.speakers[sessionID]
+		talk, longest := speaker.talk, speaker.longest
+		if !speaker.since.IsZero() && now.After(speaker.since) {
+			stretch := now.Sub(speaker.since)
+			talk += stretch
+			if stretch > longest {
+				longest = stretch
+			}
+		}
+		stats = append(stats, models.SpeakerStats{
+			SessionID:               sessionID,
+			Username:                speaker.username,
+			TalkSeconds:             talk.Seconds(),
+			LongestMonologueSeconds: longest.Seconds(),
+			Interruptions:           speaker.interruptions,
+			Interrupted:             speaker.interrupted,
+			Speaking:                !speaker.since.IsZero(),
+		})
+	}
+	return stats
+}
+
+// snapshot returns the live stats of the room, nil when nobody spoke yet
+func (t *speakingTracker) snapshot(roomId string, now time.Time) []models.SpeakerStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	room := t.rooms[roomId]
+	if room == nil {
+		return nil
+	}
+	return room.stats(now)
+}
+
+// claimBroadcast reports how long to wait before the next live broadcast.
+// It returns false when a delayed broadcast is already pending.
+func (t *speakingTracker) claimBroadcast(roomId string, now time.Time) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	room := t.rooms[roomId]
+	if room == nil || room.pending {
+		return 0, false
+	}
+	if wait := room.lastSent.Add(speakingStatsInterval).Sub(now); wait > 0 {
+		room.pending = true
+		return wait, true
+	}
+	room.lastSent = now
+	return 0, true
+}
+
+// sent records a broadcast and returns the stats to send
+func (t *speakingTracker) sent(roomId string, now time.Time) []models.SpeakerStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	room := t.rooms[roomId]
+	if room == nil {
+		return nil
+	}
+	room.pending = false
+	room.lastSent = now
+	return room.stats(now)
+}
+
+// finish closes every open stretch and forgets the room, the returned summary
+// is nil when nobody spoke
+func (t *speakingTracker) finish(roomId string, now time.Time) *models.SpeakingSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	room := t.rooms[roomId]
+	delete(t.rooms, roomId)
+	if room == nil || len(room.order) == 0 {
+		return nil
+	}
+	for _, speaker := range room.speakers {
+		speaker.stop(now)
+	}
+	return &models.SpeakingSummary{
+		RoomID:       roomId,
+		StartedAt:    room.startedAt,
+		EndedAt:      now,
+		Participants: room.stats(now),
+	}
+}
+
+// handleSpeakingState relays the state under the connection's own identity
+// and feeds it into the room's speaking stats
+func (h *MeetingHandler) handleSpeakingState(roomId string, rc *RoomConnection, speaking bool) {
+	h.broadcastToRoom(roomId, WebSocketMessage{
+		Type: "speaking_state",
+		Payload: SpeakingStatePayload{
+			SessionID:  rc.SessionID,
+			Username:   rc.Username,
+			IsSpeaking: speaking,
+		},
+	})
+	h.notifySpeaking(roomId, rc, speaking)
+}
+
+// notifySpeaking hands the change to the speaking stats of every instance
+func (h *MeetingHandler) notifySpeaking(roomId string, rc *RoomConnection, speaking bool) {
+	h.hub.Notify(roomId, noticeSpeaking, speakingNotice{
+		SessionID: rc.SessionID,
+		Username:  rc.Username,
+		Speaking:  speaking,
+		At:        time.Now(),
+	})
+}
+
+// applySpeakingNotice feeds a change from any instance into the room's stats
+func (h *MeetingHandler) applySpeakingNotice(roomId string, payload json.RawMessage) {
+	var notice speakingNotice
+	if err := json.Unmarshal(payload, &notice); err != nil {
+		h.roomLogger(roomId).Error("Error decoding speaking notice", "error", err)
+		return
+	}
+	if h.speaking.update(roomId, notice.SessionID, notice.Username, notice.Speaking, notice.At) {
+		h.broadcastSpeakingStats(roomId)
+	}
+}
+
+// broadcastSpeakingStats sends speaking_stats to the room, throttled to one
+// message per interval with a trailing message for the last change. Every
+// instance keeps the same stats and sends them to its own connections.
+func (h *MeetingHandler) broadcastSpeakingStats(roomId string) {
+	wait, ok := h.speaking.claimBroadcast(roomId, time.Now())
+	if !ok {
+		return
+	}
+	if wait > 0 {
+		time.AfterFunc(wait, func() {
+			h.sendSpeakingStats(roomId, h.speaking.sent(roomId, time.Now()))
+		})
+		return
+	}
+	h.sendSpeakingStats(roomId, h.speaking.snapshot(roomId, time.Now()))
+}
+
+func (h *MeetingHandler) sendSpeakingStats(roomId string, stats []models.SpeakerStats) {
+	if stats == nil {
+		return
+	}
+	h.hub.BroadcastLocal(roomId, WebSocketMessage{
+		Type:    "speaking_stats",
+		Payload: map[string]interface{}{"participants": stats},
+	})
+}
+
+// saveSpeakingSummary stores the stats of a room that just emptied, the
+// instance that removed the last session saves them for all
+func (h *MeetingHandler) saveSpeakingSummary(roomId string) {
+	summary := h.speaking.finish(roomId, time.Now())
+	if summary == nil {
+		return
+	}
+	if err := h.speakingStats.SaveSpeakingSummary(context.Background(), summary); err != nil {
+		h.roomLogger(roomId).Error("Error saving speaking summary", "error", err)
+	}
+}
+
+// GetSpeakingStats returns the live stats of the meeting and the summaries
+// of its past sessions, host and co-hosts only through RequireModeratorToken
+func (h *MeetingHandler) GetSpeakingStats(c echo.Context) error {
+	roomId := c.Param("roomId")
+
+	summaries, err := h.speakingStats.ListSpeakingSummaries(context.Background(), roomId)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load speaking stats"})
+	}
+
+	live := h.speaking.snapshot(roomId, time.Now())
+	if live == nil {
+		live = []models.SpeakerStats{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"room_id":   roomId,
+		"live":      live,
+		"summaries": summaries,
+	})
+}
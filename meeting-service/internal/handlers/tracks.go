@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"meeting-service/internal/logging"
+	"meeting-service/internal/models"
+	"meeting-service/internal/services"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// findMeetingWithSession loads the meeting and makes sure every given session
+// belongs to it, so clients can only touch Cloudflare sessions of their room
+func (h *MeetingHandler) findMeetingWithSession(roomId string, sessionIDs ...string) (*models.Meeting, error) {
+	meeting, err := h.store.GetMeetingByRoom(context.Background(), roomId)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Meeting not found")
+	}
+
+	for _, sessionID := range sessionIDs {
+		if !meetingHasSession(meeting, sessionID) {
+			return nil, echo.NewHTTPError(http.StatusForbidden, "Session does not belong to this meeting")
+		}
+	}
+
+	return meeting, nil
+}
+
+// ownSession returns the session in the path when it is the caller's, only the
+// owner of a Cloudflare session may publish, pull or close tracks on it
+func ownSession(c echo.Context) (string, error) {
+	sessionID := c.Param("sessionId")
+	if sessionID != joinClaims(c).SessionID {
+		return "", echo.NewHTTPError(http.StatusForbidden, "Session does not belong to the join token")
+	}
+	return sessionID, nil
+}
+
+func meetingHasSession(meeting *models.Meeting, sessionID string) bool {
+	for _, session := range meeting.Sessions {
+		if session.SessionID == sessionID {
+			return true
+		}
+	}
+	return false
+}
+
+// cloudflareErrorResponse keeps the errorCode/errorDescription shape of the
+// Cloudflare API so clients can keep reacting to e.g. "Session is not ready yet"
+func cloudflareErrorResponse(c echo.Context, err error) error {
+	var apiErr *services.APIError
+	if errors.As(err, &apiErr) {
+		status := apiErr.StatusCode
+		if status < 400 {
+			status = http.StatusBadGateway
+		}
+		return c.JSON(status, apiErr)
+	}
+	return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+}
+
+func authorizationErrorResponse(c echo.Context, err error) error {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return c.JSON(httpErr.Code, map[string]interface{}{"error": httpErr.Message})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
+
+func (h *MeetingHandler) AddTracks(c echo.Context) error {
+	roomId := c.Param("roomId")
+	sessionID, err := ownSession(c)
+	if err != nil {
+		return authorizationErrorResponse(c, err)
+	}
+
+	var req services.TracksRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// Remote tracks may only be pulled from sessions in the same meeting
+	sessionIDs := []string{sessionID}
+	for _, track := range req.Tracks {
+		if track.Location == "remote" {
+			sessionIDs = append(sessionIDs, track.SessionID)
+		}
+	}
+	if _, err := h.findMeetingWithSession(roomId, sessionIDs...); err != nil {
+		return authorizationErrorResponse(c, err)
+	}
+
+	resp, err := h.cloudflare.AddTracks(c.Request().Context(), sessionID, &req)
+	if err != nil {
+		return cloudflareErrorResponse(c, err)
+	}
+
+	// Remember the published audio tracks so a moderator's mute can close them
+	if mids := publishedAudioMids(&req); len(mids) > 0 {
+		if err := h.store.AddAudioMids(c.Request().Context(), roomId, sessionID, mids); err != nil {
+			logging.From(c).Error("Error recording audio tracks", "error", err)
+		}
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// publishedAudioMids returns the mids of the local tracks that the offer
+// describes as audio
+func publishedAudioMids(req *services.TracksRequest) []string {
+	if req.SessionDescription == nil {
+		return nil
+	}
+	audio := make(map[string]bool)
+	kind := ""
+	for _, line := range strings.Split(req.SessionDescription.SDP, "\n") {
+		line = strings.TrimSpace(line)
+		if media, ok := strings.CutPrefix(line, "m="); ok {
+			kind, _, _ = strings.Cut(media, " ")
+		} else if mid, ok := strings.CutPrefix(line, "a=mid:"); ok && kind == "audio" {
+			audio[mid] = true
+		}
+	}
+
+	var mids []string
+	for _, track := range req.Tracks {
+		if track.Location == "local" && audio[track.Mid] {
+			mids = append(mids, track.Mid)
+		}
+	}
+	return mids
+}
+
+func (h *MeetingHandler) Renegotiate(c echo.Context) error {
+	roomId := c.Param("roomId")
+	sessionID, err := ownSession(c)
+	if err != nil {
+		return authorizationErrorResponse(c, err)
+	}
+
+	var req services.RenegotiateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if _, err := h.findMeetingWithSession(roomId, sessionID); err != nil {
+		return authorizationErrorResponse(c, err)
+	}
+
+	resp, err := h.cloudflare.Renegotiate(c.Request().Context(), sessionID, &req)
+	if err != nil {
+		return cloudflareErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+func (h *MeetingHandler) CloseTracks(c echo.Context) error {
+	roomId := c.Param("roomId")
+	sessionID, err := ownSession(c)
+	if err != nil {
+		return authorizationErrorResponse(c, err)
+	}
+
+	var req services.CloseTracksRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if _, err := h.findMeetingWithSession(roomId, sessionID); err != nil {
+		return authorizationErrorResponse(c, err)
+	}
+
+	resp, err := h.cloudflare.CloseTracks(c.Request().Context(), sessionID, &req)
+	if err != nil {
+		return cloudflareErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// GetSessionState lists the tracks of the caller's session or of another
+// participant's, which clients need to pull them
+func (h *MeetingHandler) GetSessionState(c echo.Context) error {
+	roomId := c.Param("roomId")
+	sessionID := c.Param("sessionId")
+
+	if _, err := h.findMeetingWithSession(roomId, joinClaims(c).SessionID, sessionID); err != nil {
+		return authorizationErrorResponse(c, err)
+	}
+
+	resp, err := h.cloudflare.GetSessionState(c.Request().Context(), sessionID)
+	if err != nil {
+		return cloudflareErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+
+	"meeting-service/internal/services"
+)
+
+func TestPublishedAudioMids(t *testing.T) {
+	offer := "v=0\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\na=mid:0\r\n" +
+		"m=video 9 UDP/TLS/RTP/SAVPF 96\r\na=mid:1\r\n" +
+		"m=audio 9 UDP/TLS/RTP/SAVPF 111\r\na=mid:2\r\n"
+
+	tests := []struct {
+		name string
+		req  services.TracksRequest
+		want []string
+	}{
+		{
+			name: "local audio tracks",
+			req: services.TracksRequest{
+				SessionDescription: &services.SessionDescription{SDP: offer, Type: "offer"},
+				Tracks: []services.TrackObject{
+					{Location: "local", Mid: "0", TrackName: "mic"},
+					{Location: "local", Mid: "1", TrackName: "camera"},
+				},
+			},
+			want: []string{"0"},
+		},
+		{
+			name: "remote tracks are not published",
+			req: services.TracksRequest{
+				SessionDescription: &services.SessionDescription{SDP: offer, Type: "offer"},
+				Tracks:             []services.TrackObject{{Location: "remote", Mid: "2", SessionID: "other", TrackName: "mic"}},
+			},
+		},
+		{
+			name: "no offer",
+			req:  services.TracksRequest{Tracks: []services.TrackObject{{Location: "local", Mid: "0"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := publishedAudioMids(&tt.req); !slices.Equal(got, tt.want) {
+				t.Errorf("publishedAudioMids() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"meeting-service/internal/store"
+	"sync"
+	"time"
+)
+
+const (
+	// How long a stopped room keeps its resume token, covers the last
+	// participant reconnecting after a page refresh
+	resumeTokenRetention = 2 * time.Minute
+	// Delay before reopening a change stream that failed
+	watchRetryDelay = 2 * time.Second
+)
+
+type roomWatcher struct {
+	refs        int
+	cancel      context.CancelFunc
+	resumeToken []byte
+}
+
+type savedResumeToken struct {
+	token   []byte
+	savedAt time.Time
+}
+
+// watcherRegistry runs one meeting change stream per room, shared by all of
+// the room's connections and cancelled when the last one leaves
+type watcherRegistry struct {
+	mu       sync.Mutex
+	store    store.MeetingStore
+	watchers map[string]*roomWatcher
+	saved    map[string]savedResumeToken
+	onChange func(roomId string, change store.MeetingChange)
+	logger   *slog.Logger
+	// running counts the change stream goroutines for stopAll
+	running sync.WaitGroup
+}
+
+func newWatcherRegistry(meetingStore store.MeetingStore, onChange func(roomId string, change store.MeetingChange), logger *slog.Logger) *watcherRegistry {
+	return &watcherRegistry{
+		store:    meetingStore,
+		watchers: make(map[string]*roomWatcher),
+		saved:    make(map[string]savedResumeToken),
+		onChange: onChange,
+		logger:   logger,
+	}
+}
+
+// acquire is called for every connection joining the room, the first one
+// starts the change stream
+func (r *watcherRegistry) acquire(roomId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if w, ok := r.watchers[roomId]; ok {
+		w.refs++
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &roomWatcher{refs: 1, cancel: cancel}
+	if saved, ok := r.saved[roomId]; ok && time.Since(saved.savedAt) < resumeTokenRetention {
+		w.resumeToken = saved.token
+	}
+	delete(r.saved, roomId)
+	r.watchers[roomId] = w
+
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		r.run(ctx, roomId, w)
+	}()
+}
+
+// release is called for every connection leaving the room, the last one
+// cancels the change stream and keeps its resume token for a while
+func (r *watcherRegistry) release(roomId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.watchers[roomId]
+	if !ok {
+		return
+	}
+	w.refs--
+	if w.refs > 0 {
+		return
+	}
+
+	w.cancel()
+	delete(r.watchers, roomId)
+	if w.resumeToken != nil {
+		r.saved[roomId] = savedResumeToken{token: w.resumeToken, savedAt: time.Now()}
+	}
+	r.pruneLocked()
+}
+
+// stopAll cancels every change stream and waits until they are closed or ctx
+// is done
+func (r *watcherRegistry) stopAll(ctx context.Context) error {
+	r.mu.Lock()
+	for roomId, w := range r.watchers {
+		w.cancel()
+		delete(r.watchers, roomId)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *watcherRegistry) pruneLocked() {
+	for roomId, saved := range r.saved {
+		if time.Since(saved.savedAt) >= resumeTokenRetention {
+			delete(r.saved, roomId)
+		}
+	}
+}
+
+// run keeps the room's change stream open until ctx is cancelled, resuming
+// after the last seen change whenever the stream has to be reopened
+func (r *watcherRegistry) run(ctx context.Context, roomId string, w *roomWatcher) {
+	for ctx.Err() == nil {
+		r.mu.Lock()
+		resumeToken := w.resumeToken
+		r.mu.Unlock()
+
+		updates, err := r.store.WatchMeeting(ctx, roomId, resumeToken)
+		if err != nil && resumeToken != nil {
+			// The token may have fallen out of the oplog, start fresh instead
+			r.logger.Warn("Error resuming change stream", "room_id", roomId, "error", err)
+			r.mu.Lock()
+			w.resumeToken = nil
+			r.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			r.logger.Error("Error creating change stream", "room_id", roomId, "error", err)
+		} else {
+			for change := range updates {
+				if change.ResumeToken != nil {
+					r.mu.Lock()
+					w.resumeToken = change.ResumeToken
+					r.mu.Unlock()
+				}
+				r.onChange(roomId, change)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(watchRetryDelay):
+		}
+	}
+}
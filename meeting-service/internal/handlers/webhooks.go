@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"meeting-service/internal/models"
+	"meeting-service/internal/services"
+	"meeting-service/internal/store"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CreateWebhookRequest struct {
+	URL string `json:"url"`
+	// Events to receive, all events when empty
+	Events []string `json:"events"`
+}
+
+// CreateWebhookResponse is the only place the signing secret is returned
+type CreateWebhookResponse struct {
+	*models.Webhook
+	Secret string `json:"secret"`
+}
+
+// emitWebhook queues the event without holding up the caller, it is a no-op
+// when webhooks are disabled
+func (h *MeetingHandler) emitWebhook(roomId, event string, data interface{}) {
+	if h.webhooks == nil {
+		return
+	}
+	go h.webhooks.Emit(roomId, event, data)
+}
+
+// requireHost checks that the join token belongs to the meeting's host
+func (h *MeetingHandler) requireHost(c echo.Context) error {
+	meeting, err := h.store.GetMeetingByRoom(context.Background(), c.Param("roomId"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Meeting not found")
+	}
+
+	actor := meeting.FindSession(joinClaims(c).SessionID)
+	if actor == nil || meeting.RoleOf(actor.UserID) != models.RoleHost {
+		return echo.NewHTTPError(http.StatusForbidden, errHostOnly.Error())
+	}
+	return nil
+}
+
+// CreateWebhook registers an endpoint for the meeting's lifecycle events
+func (h *MeetingHandler) CreateWebhook(c echo.Context) error {
+	var req CreateWebhookRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.requireHost(c); err != nil {
+		return authorizationErrorResponse(c, err)
+	}
+
+	webhook, err := h.webhooks.Register(context.Background(), c.Param("roomId"), req.URL, req.Events)
+	if errors.Is(err, services.ErrInvalidWebhook) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save webhook"})
+	}
+
+	return c.JSON(http.StatusCreated, CreateWebhookResponse{
+		Webhook: webhook,
+		Secret:  webhook.Secret,
+	})
+}
+
+func (h *MeetingHandler) ListWebhooks(c echo.Context) error {
+	if err := h.requireHost(c); err != nil {
+		return authorizationErrorResponse(c, err)
+	}
+
+	webhooks, err := h.webhooks.List(context.Background(), c.Param("roomId"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to list webhooks"})
+	}
+
+	return c.JSON(http.StatusOK, webhooks)
+}
+
+func (h *MeetingHandler) DeleteWebhook(c echo.Context) error {
+	id, err := primitive.ObjectIDFromHex(c.Param("webhookId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid webhook ID"})
+	}
+
+	if err := h.requireHost(c); err != nil {
+		return authorizationErrorResponse(c, err)
+	}
+
+	err = h.webhooks.Delete(context.Background(), c.Param("roomId"), id)
+	if err == store.ErrWebhookNotFound {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Webhook not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete webhook"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -2,17 +2,18 @@ package handlers
 
 import (
 	"context"
-	"log"
+	"encoding/json"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
-	"meeting-service/internal/database"
-	"meeting-service/internal/models" // Add this import
+	"meeting-service/internal/logging"
+	"meeting-service/internal/models"
+	"meeting-service/internal/store"
 
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
-	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 var (
@@ -25,30 +26,35 @@ var (
 		ReadBufferSize:   1024,
 		WriteBufferSize:  1024,
 	}
-
-	// Store room connections
-	rooms      = make(map[string]map[*websocket.Conn]*RoomConnection)
-	roomsMutex sync.RWMutex
 )
 
-// Thêm một struct để lưu trữ thông tin kết nối đầy đủ
-type RoomConnection struct {
-	Username  string
-	SessionID string // Thêm SessionID
-	Conn      *websocket.Conn
-}
-
 type WebSocketMessage struct {
 	Type    string      `json:"type"`
 	Payload interface{} `json:"payload"`
+	// Seq numbers the messages broadcast to a room, direct replies have none
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// RoomStatePayload is the meeting plus the most recent chat messages
+type RoomStatePayload struct {
+	*models.Meeting
+	ChatHistory []models.ChatMessage `json:"chat_history"`
 }
 
 // Add new speaking state structure
 type SpeakingStatePayload struct {
+	SessionID  string `json:"session_id"`
 	Username   string `json:"username"`
 	IsSpeaking bool   `json:"isSpeaking"`
 }
 
+// WavePayload is relayed to the room when someone waves
+type WavePayload struct {
+	SessionID string `json:"session_id"`
+	Username  string `json:"username"`
+	Timestamp string `json:"timestamp"`
+}
+
 // Thêm hàm để thông báo người tham gia mới
 func (h *MeetingHandler) notifyNewParticipant(roomId string, sessionId string, username string) {
 	h.broadcastToRoom(roomId, WebSocketMessage{
@@ -59,6 +65,10 @@ func (h *MeetingHandler) notifyNewParticipant(roomId string, sessionId string, u
 			"tracks":     nil, // Will be populated when tracks are ready
 		},
 	})
+	h.emitWebhook(roomId, models.EventParticipantJoined, map[string]string{
+		"session_id": sessionId,
+		"username":   username,
+	})
 }
 
 func (h *MeetingHandler) notifyTracksReady(roomId string, sessionId string, username string) {
@@ -76,7 +86,7 @@ func (h *MeetingHandler) HandleWebSocket(c echo.Context) error {
 	// Enable CORS for WebSocket
 	c.Response().Header().Set("Access-Control-Allow-Origin", "*")
 	c.Response().Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	c.Response().Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	c.Response().Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 	// Handle preflight
 	if c.Request().Method == "OPTIONS" {
@@ -84,109 +94,137 @@ func (h *MeetingHandler) HandleWebSocket(c echo.Context) error {
 	}
 
 	roomId := c.Param("roomId")
-	username := c.QueryParam("username")
-
-	// Get session ID from database first
-	collection := database.GetCollection("meetings")
-	var meeting models.Meeting
-	err := collection.FindOne(
-		context.Background(),
-		bson.M{"room_id": roomId},
-	).Decode(&meeting)
+	claims := joinClaims(c)
 
+	// The token identifies the session, make sure it is still part of the meeting
+	meeting, err := h.store.GetMeetingByRoom(context.Background(), roomId)
 	if err != nil {
-		return err
+		return echo.NewHTTPError(http.StatusNotFound, "Meeting not found")
 	}
 
-	// Find session ID for this user
-	var sessionID string
-	for _, session := range meeting.Sessions {
-		if session.Username == username {
-			sessionID = session.SessionID
-			break
-		}
+	session := meeting.FindSession(claims.SessionID)
+	if session == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Session not found")
 	}
+	username, sessionID := session.Username, session.SessionID
 
-	if sessionID == "" {
-		return echo.NewHTTPError(http.StatusNotFound, "Session not found")
+	version, err := negotiateProtocol(c.QueryParam("protocol_version"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	resumeToken := c.QueryParam("resume_token")
+	var lastSeq uint64
+	if resumeToken != "" {
+		lastSeq, err = strconv.ParseUint(c.QueryParam("last_seq"), 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid last_seq")
+		}
 	}
 
 	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		logging.From(c).Warn("WebSocket upgrade error", "error", err)
 		return err
 	}
 
-	// Set ping handler
-	ws.SetPingHandler(func(string) error {
-		ws.WriteControl(websocket.PongMessage, []byte{}, time.Now().Add(10*time.Second))
-		return nil
-	})
-
 	// Set read deadline
 	ws.SetReadDeadline(time.Now().Add(60 * time.Second))
-
-	// Register connection with session ID
-	roomsMutex.Lock()
-	if rooms[roomId] == nil {
-		rooms[roomId] = make(map[*websocket.Conn]*RoomConnection)
+	ws.SetReadLimit(maxClientMessageSize)
+
+	// Register connection with session ID, this also starts its writer
+	rc := newRoomConnection(ws, session, h.hub.backlog, logging.From(c))
+	rc.Protocol = version
+
+	// A client coming back after a drop continues its session, when that is
+	// no longer possible it simply joins again and is told why
+	var resumeAfter *uint64
+	var resumeRejected string
+	if resumeToken != "" {
+		previous, err := h.resumes.resume(resumeToken, roomId, sessionID)
+		if err != nil {
+			rc.log.Info("Resume rejected, joining again", "error", err)
+			resumeRejected = err.Error()
+		} else {
+			resumeAfter = &lastSeq
+			if previous != nil {
+				previous.CloseWithReason(closeSuperseded, "resumed on a new connection")
+			}
+		}
+	}
+	// Whatever else is left of the session belongs to this connection now
+	for _, previous := range h.resumes.supersede(roomId, sessionID) {
+		previous.CloseWithReason(closeSuperseded, "session continued on a new connection")
 	}
-	rooms[roomId][ws] = &RoomConnection{
-		Username:  username,
-		SessionID: sessionID,
-		Conn:      ws,
+	h.claimSession(roomId, sessionID)
+	h.resumes.issue(roomId, rc)
+
+	// The hello confirms the protocol version before anything else is sent
+	replayed, ok := h.registerSocket(roomId, rc, resumeAfter, func(seq uint64, replayed bool) WebSocketMessage {
+		return WebSocketMessage{
+			Type: "hello",
+			Payload: HelloPayload{
+				ProtocolVersion: version,
+				SessionID:       sessionID,
+				Username:        username,
+				Seq:             seq,
+				ResumeToken:     rc.resumeToken,
+				Resumed:         resumeAfter != nil,
+				Replayed:        replayed,
+				ResumeRejected:  resumeRejected,
+			},
+		}
+	})
+	if !ok {
+		// Shutdown started during the upgrade
+		h.resumes.forget(rc)
+		ws.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server shutdown"),
+			time.Now().Add(time.Second),
+		)
+		ws.Close()
+		return nil
 	}
-	roomsMutex.Unlock()
+	h.recordAttendance(roomId, session, models.AttendanceConnect)
 
 	// Notify others about new participant with correct session ID
-	h.notifyNewParticipant(roomId, sessionID, username)
-
-	// Send initial room state
-	go h.sendRoomState(roomId, ws)
+	if resumeAfter == nil {
+		h.notifyNewParticipant(roomId, sessionID, username)
+	}
 
-	// Start MongoDB change stream
-	go h.watchRoomChanges(roomId)
+	// Send initial room state, a resumed client got what it missed instead
+	if !replayed {
+		go h.sendRoomState(roomId, rc)
+	}
 
-	// Start heartbeat
-	go h.startHeartbeat(ws)
+	// Share the room's change stream, the first connection starts it
+	h.watchers.acquire(roomId)
 
 	// Handle WebSocket messages
-	go h.handleWebSocketConnection(roomId, ws, username)
+	go h.handleWebSocketConnection(roomId, rc)
 
 	return nil
 }
 
-func (h *MeetingHandler) startHeartbeat(ws *websocket.Conn) {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		if err := ws.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
-			log.Printf("Heartbeat error: %v", err)
-			return
-		}
-	}
-}
+func (h *MeetingHandler) handleWebSocketConnection(roomId string, rc *RoomConnection) {
+	ws := rc.Conn
+	resumable := false
 
-func (h *MeetingHandler) handleWebSocketConnection(roomId string, ws *websocket.Conn, username string) {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("Recovered from panic in handleWebSocketConnection: %v", r)
+			rc.log.Error("Recovered from panic in handleWebSocketConnection", "panic", r)
 		}
-		h.handleParticipantLeave(roomId, ws, username)
-		ws.WriteControl(
-			websocket.CloseMessage,
-			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
-			time.Now().Add(time.Second),
-		)
-		ws.Close()
+		h.handleParticipantLeave(roomId, rc, resumable)
+		rc.Close()
+		h.drain.sockets.Done()
 	}()
 
-	// Set ping handler
+	// Set ping handler, WriteControl is safe to use next to the writer goroutine
 	ws.SetPingHandler(func(data string) error {
 		err := ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
 		if err != nil {
-			log.Printf("Error sending pong: %v", err)
+			rc.log.Warn("Error sending pong", "error", err)
 		}
 		return err
 	})
@@ -198,150 +236,152 @@ func (h *MeetingHandler) handleWebSocketConnection(roomId string, ws *websocket.
 	})
 
 	for {
-		var msg WebSocketMessage
-		err := ws.ReadJSON(&msg)
+		_, data, err := ws.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
-				log.Printf("WebSocket read error: %v", err)
+				rc.log.Warn("WebSocket read error", "error", err)
 			}
+			// Only a socket that dropped without a close handshake may come back
+			resumable = !rc.closing() &&
+				!websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway)
 			break
 		}
 
-		switch msg.Type {
-		case "ping":
-			err = ws.WriteJSON(WebSocketMessage{Type: "pong"})
-			if err != nil {
-				log.Printf("Error sending pong: %v", err)
-				break
-			}
-		case "wave":
-			if _, ok := msg.Payload.(map[string]interface{}); !ok {
-				log.Printf("Invalid wave payload format")
-				continue
-			}
-
-			h.broadcastToRoom(roomId, WebSocketMessage{
-				Type: "wave",
-				Payload: map[string]interface{}{
-					"username":  username,
-					"timestamp": time.Now().Format(time.RFC3339),
-				},
-			})
-		case "speaking_state":
-			// Broadcast speaking state to all participants in room
-			h.broadcastToRoom(roomId, msg)
-		case "chat_message":
-			// Validate chat message payload
-			if payload, ok := msg.Payload.(map[string]interface{}); ok {
-				if content, exists := payload["content"].(string); exists && content != "" {
-					// Broadcast chat message to all participants
-					h.broadcastToRoom(roomId, WebSocketMessage{
-						Type: "chat_message",
-						Payload: map[string]interface{}{
-							"username":  username,
-							"content":   content,
-							"timestamp": time.Now().Format(time.RFC3339),
-						},
-					})
-				}
-			}
-		}
+		h.handleClientMessage(roomId, rc, data)
 
 		ws.SetReadDeadline(time.Now().Add(60 * time.Second))
 	}
 }
 
-func (h *MeetingHandler) handleParticipantLeave(roomId string, ws *websocket.Conn, username string) {
-	roomsMutex.Lock()
-	delete(rooms[roomId], ws)
-	if len(rooms[roomId]) == 0 {
-		delete(rooms, roomId)
-	}
-	roomsMutex.Unlock()
-
-	// Update MongoDB
-	collection := database.GetCollection("meetings")
-	_, err := collection.UpdateOne(
-		context.Background(),
-		bson.M{"room_id": roomId},
-		bson.M{
-			"$pull": bson.M{
-				"sessions": bson.M{"username": username},
-			},
+// handleWave relays a wave under the sender's own identity
+func (h *MeetingHandler) handleWave(roomId string, rc *RoomConnection) {
+	h.broadcastToRoom(roomId, WebSocketMessage{
+		Type: "wave",
+		Payload: WavePayload{
+			SessionID: rc.SessionID,
+			Username:  rc.Username,
+			Timestamp: time.Now().Format(time.RFC3339),
 		},
-	)
+	})
+}
+
+// handleParticipantLeave runs when a socket is gone. A session that dropped
+// and may be resumed only leaves the room once the resume window is over.
+func (h *MeetingHandler) handleParticipantLeave(roomId string, rc *RoomConnection, resumable bool) {
+	empty := h.hub.Unregister(roomId, rc)
+	h.watchers.release(roomId)
+	session := &models.Session{UserID: rc.UserID, Username: rc.Username, SessionID: rc.SessionID}
+	h.recordAttendance(roomId, session, models.AttendanceDisconnect)
+
+	draining := h.isDraining()
+	result := h.resumes.detach(rc, resumable && !draining, func() {
+		h.leaveRoom(roomId, rc)
+	})
+	if result == sessionSuperseded {
+		// The session lives on in the connection that resumed it
+		return
+	}
+
+	h.notifySpeaking(roomId, rc, false)
+	if draining {
+		// The client reconnects to another instance, keep its session. Without
+		// a shared broker no other instance carries on the room's stats.
+		if empty && h.hub.Standalone() {
+			h.saveSpeakingSummary(roomId)
+		}
+		return
+	}
+	if result == sessionLeft {
+		h.leaveRoom(roomId, rc)
+	}
+}
+
+// leaveRoom removes the connection's session and tells the room. The last one
+// out on this instance drops the replay buffer, whoever removes the meeting's
+// last session closes the room for every instance.
+func (h *MeetingHandler) leaveRoom(roomId string, rc *RoomConnection) {
+	session := &models.Session{UserID: rc.UserID, Username: rc.Username, SessionID: rc.SessionID}
+	if len(h.hub.Connections(roomId)) == 0 && !h.resumes.parked(roomId, "") {
+		h.hub.Forget(roomId)
+	}
+
+	// Remove the session, it is already gone after an explicit leave or a
+	// removal and whoever removed it told the room
+	_, last, err := h.store.RemoveSession(context.Background(), roomId, rc.SessionID)
+	if err == store.ErrSessionNotFound {
+		return
+	}
 	if err != nil {
-		log.Printf("Error removing session: %v", err)
+		rc.log.Error("Error removing session", "error", err)
 		return
 	}
+	h.recordAttendance(roomId, session, models.AttendanceLeave)
+	h.emitWebhook(roomId, models.EventParticipantLeft, map[string]string{
+		"session_id": rc.SessionID,
+		"username":   rc.Username,
+		"reason":     "disconnected",
+	})
 
 	// Notify remaining participants
 	h.broadcastToRoom(roomId, WebSocketMessage{
 		Type: "participant_left",
 		Payload: map[string]string{
-			"username": username,
+			"username":   rc.Username,
+			"session_id": rc.SessionID,
 		},
 	})
+	if last {
+		h.roomEmptied(roomId)
+	}
 }
 
-func (h *MeetingHandler) sendRoomState(roomId string, ws *websocket.Conn) {
-	collection := database.GetCollection("meetings")
-	var meeting models.Meeting
-	err := collection.FindOne(
-		context.Background(),
-		bson.M{"room_id": roomId},
-	).Decode(&meeting)
-
-	if err != nil {
-		log.Printf("Error fetching room state: %v", err)
-		return
-	}
+// noticeRoomClosed tells every instance that the meeting's last session is gone
+const noticeRoomClosed = "room_closed"
 
-	ws.WriteJSON(WebSocketMessage{
-		Type:    "room_state",
-		Payload: meeting,
-	})
+// roomEmptied runs once, on the instance that removed the meeting's last
+// session. It comes after that participant's own leave event.
+func (h *MeetingHandler) roomEmptied(roomId string) {
+	h.saveSpeakingSummary(roomId)
+	h.hub.Notify(roomId, noticeRoomClosed, nil)
+	h.emitWebhook(roomId, models.EventRoomEmpty, map[string]string{})
 }
 
-func (h *MeetingHandler) broadcastToRoom(roomId string, msg WebSocketMessage) {
-	roomsMutex.RLock()
-	defer roomsMutex.RUnlock()
-
-	for ws := range rooms[roomId] {
-		ws.WriteJSON(msg)
-	}
+// forgetRoom drops what this instance still holds for a closed room
+func (h *MeetingHandler) forgetRoom(roomId string, _ json.RawMessage) {
+	h.speaking.finish(roomId, time.Now())
 }
 
-func (h *MeetingHandler) watchRoomChanges(roomId string) {
-	collection := database.GetCollection("meetings")
-	pipeline := []bson.M{
-		{
-			"$match": bson.M{
-				"$and": []bson.M{
-					{"operationType": "update"},
-					{"fullDocument.room_id": roomId},
-				},
-			},
-		},
+func (h *MeetingHandler) sendRoomState(roomId string, rc *RoomConnection) {
+	meeting, err := h.store.GetMeetingByRoom(context.Background(), roomId)
+	if err != nil {
+		rc.log.Error("Error fetching room state", "error", err)
+		return
 	}
 
-	changeStream, err := collection.Watch(context.Background(), pipeline)
+	history, err := h.chats.ListChatMessages(context.Background(), roomId, rc.UserID, primitive.NilObjectID, roomStateChatHistory)
 	if err != nil {
-		log.Printf("Error creating change stream: %v", err)
-		return
+		rc.log.Error("Error fetching chat history", "error", err)
+		history = []models.ChatMessage{}
 	}
-	defer changeStream.Close(context.Background())
 
-	for changeStream.Next(context.Background()) {
-		var changeDoc bson.M
-		if err := changeStream.Decode(&changeDoc); err != nil {
-			log.Printf("Error decoding change stream document: %v", err)
-			continue
-		}
+	rc.Send(WebSocketMessage{
+		Type: "room_state",
+		Payload: RoomStatePayload{
+			Meeting:     meeting,
+			ChatHistory: history,
+		},
+	})
+}
 
-		h.broadcastToRoom(roomId, WebSocketMessage{
-			Type:    "room_updated",
-			Payload: changeDoc["fullDocument"],
-		})
-	}
+func (h *MeetingHandler) broadcastToRoom(roomId string, msg WebSocketMessage) {
+	h.hub.Broadcast(roomId, msg)
+}
+
+// sendRoomUpdate passes a change seen by this instance's change stream on to
+// its own connections, every instance with connections in the room runs one
+func (h *MeetingHandler) sendRoomUpdate(roomId string, change store.MeetingChange) {
+	h.hub.BroadcastLocal(roomId, WebSocketMessage{
+		Type:    "room_updated",
+		Payload: change.Meeting,
+	})
 }
@@ -0,0 +1,168 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Echo context key of the request scoped logger
+const loggerKey = "logger"
+
+// New builds the service logger, level is debug, info, warn or error and
+// format is json or text
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+}
+
+// From returns the request's logger, it carries the request and room IDs and,
+// once the join token is verified, the session ID and username
+func From(c echo.Context) *slog.Logger {
+	if logger, ok := c.Get(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// With adds fields to the request's logger for the rest of the request
+func With(c echo.Context, args ...any) *slog.Logger {
+	logger := From(c).With(args...)
+	c.Set(loggerKey, logger)
+	return logger
+}
+
+// Middleware attaches a request scoped logger and writes one access log line
+// per request. Only the path is logged, query strings may carry join tokens.
+// It expects middleware.RequestID to run first.
+func Middleware(logger *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			req := c.Request()
+
+			fields := []any{"request_id", c.Response().Header().Get(echo.HeaderXRequestID)}
+			if roomID := roomParam(c); roomID != "" {
+				fields = append(fields, "room_id", roomID)
+			}
+			c.Set(loggerKey, logger.With(fields...))
+
+			err := next(c)
+			if err != nil {
+				// Let the error handler write the response so the status is known
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			attrs := []any{
+				"method", req.Method,
+				"path", req.URL.Path,
+				"route", c.Path(),
+				"status", status,
+				"latency", time.Since(start),
+				"remote_ip", c.RealIP(),
+			}
+			if err != nil {
+				attrs = append(attrs, "error", err.Error())
+			}
+			From(c).Log(req.Context(), level, "request", attrs...)
+			return nil
+		}
+	}
+}
+
+func roomParam(c echo.Context) string {
+	if roomID := c.Param("roomId"); roomID != "" {
+		return roomID
+	}
+	return c.Param("roomID")
+}
+
+// BodyDump logs request and response bodies at debug level with credentials
+// redacted, it is a no-op unless the logger has debug enabled
+func BodyDump(logger *slog.Logger) echo.MiddlewareFunc {
+	return middleware.BodyDumpWithConfig(middleware.BodyDumpConfig{
+		Skipper: func(c echo.Context) bool {
+			return !logger.Enabled(c.Request().Context(), slog.LevelDebug)
+		},
+		Handler: func(c echo.Context, reqBody, resBody []byte) {
+			From(c).Debug("body",
+				"request_body", string(Redact(reqBody)),
+				"response_body", string(Redact(resBody)),
+			)
+		},
+	})
+}
+
+// Fields whose values never appear in logs, matched case-insensitively
+// against JSON keys. SDP carries the ICE credentials of the peer connection.
+var sensitiveKeys = []string{"token", "secret", "passcode", "password", "authorization", "sdp"}
+
+// Redact replaces the values of credential fields in a JSON body. Bodies that
+// are not JSON are dropped entirely since they cannot be inspected.
+func Redact(body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return []byte("[non-JSON body omitted]")
+	}
+	redacted, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return []byte("[body omitted]")
+	}
+	return redacted
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isSensitive(key) {
+				v[key] = "[REDACTED]"
+			} else {
+				v[key] = redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactValue(v[i])
+		}
+	}
+	return value
+}
+
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "meeting"
+
+var (
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	wsMessagesReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ws_messages_received_total",
+		Help:      "WebSocket messages received from clients by type.",
+	}, []string{"type"})
+
+	wsMessagesSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ws_messages_sent_total",
+		Help:      "WebSocket messages queued to clients by type.",
+	}, []string{"type"})
+
+	cloudflareRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cloudflare_request_duration_seconds",
+		Help:      "Cloudflare Calls API latency by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	cloudflareErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cloudflare_errors_total",
+		Help:      "Failed Cloudflare Calls API requests by operation.",
+	}, []string{"operation"})
+
+	mongoCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_command_duration_seconds",
+		Help:      "MongoDB command latency by command and outcome.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command", "status"})
+)
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterRooms exposes the active rooms and connections, stats is called
+// on every scrape
+func RegisterRooms(stats func() (rooms, connections int)) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_rooms",
+		Help:      "Rooms with at least one WebSocket connection.",
+	}, func() float64 {
+		rooms, _ := stats()
+		return float64(rooms)
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_connections",
+		Help:      "Open WebSocket connections.",
+	}, func() float64 {
+		_, connections := stats()
+		return float64(connections)
+	})
+}
+
+// Middleware records the latency of every request under its route pattern,
+// WebSocket upgrades are skipped since they last as long as the connection
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if strings.EqualFold(c.Request().Header.Get(echo.HeaderUpgrade), "websocket") {
+				return next(c)
+			}
+
+			start := time.Now()
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil && !c.Response().Committed {
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) {
+					status = httpErr.Code
+				} else {
+					status = http.StatusInternalServerError
+				}
+			}
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+
+			httpRequestDuration.
+				WithLabelValues(route, c.Request().Method, strconv.Itoa(status)).
+				Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// WSMessageReceived counts an inbound message, callers map unknown client
+// supplied types to a fixed label
+func WSMessageReceived(msgType string) {
+	wsMessagesReceived.WithLabelValues(msgType).Inc()
+}
+
+// WSMessagesSent counts n outbound messages of one type
+func WSMessagesSent(msgType string, n int) {
+	if n > 0 {
+		wsMessagesSent.WithLabelValues(msgType).Add(float64(n))
+	}
+}
+
+// ObserveCloudflare records one Cloudflare API call
+func ObserveCloudflare(operation string, duration time.Duration, err error) {
+	cloudflareRequestDuration.WithLabelValues(operation).Observe(duration.Seconds())
+	if err != nil {
+		cloudflareErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// ObserveMongo records one MongoDB command
+func ObserveMongo(command string, duration time.Duration, failed bool) {
+	status := "ok"
+	if failed {
+		status = "error"
+	}
+	mongoCommandDuration.WithLabelValues(command, status).Observe(duration.Seconds())
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Attendance event types
+const (
+	AttendanceJoin       = "join"
+	AttendanceConnect    = "connect"
+	AttendanceDisconnect = "disconnect"
+	AttendanceLeave      = "leave"
+)
+
+// AttendanceEvent records a participant's session entering or leaving a room
+type AttendanceEvent struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	RoomID    string             `bson:"room_id" json:"room_id"`
+	SessionID string             `bson:"session_id" json:"session_id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Username  string             `bson:"username" json:"username"`
+	Type      string             `bson:"type" json:"type"`
+	At        time.Time          `bson:"at" json:"at"`
+}
+
+func NewAttendanceEvent(roomID string, session *Session, eventType string) *AttendanceEvent {
+	return &AttendanceEvent{
+		RoomID:    roomID,
+		SessionID: session.SessionID,
+		UserID:    session.UserID,
+		Username:  session.Username,
+		Type:      eventType,
+		At:        time.Now(),
+	}
+}
+
+// AttendanceRecord summarises one participant's attendance. Sessions of the
+// same participant, like a screen share, count towards the same record.
+type AttendanceRecord struct {
+	ParticipantID primitive.ObjectID `json:"participant_id"`
+	Username      string             `json:"username"`
+	FirstJoin     time.Time          `json:"first_join"`
+	// LastLeave is nil while the participant is still in the meeting
+	LastLeave         *time.Time    `json:"last_leave"`
+	ConnectedDuration time.Duration `json:"-"`
+	ConnectedSeconds  int64         `json:"connected_seconds"`
+	Reconnects        int           `json:"reconnects"`
+}
+
+// BuildAttendanceReport folds the ordered events of a room into one record per
+// participant. Connections still open are counted up to now.
+func BuildAttendanceReport(events []AttendanceEvent, now time.Time) []AttendanceRecord {
+	type participant struct {
+		record   AttendanceRecord
+		connects int
+		open     map[string]time.Time
+		present  map[string]bool
+	}
+
+	var order []primitive.ObjectID
+	participants := make(map[primitive.ObjectID]*participant)
+
+	for _, event := range events {
+		p, ok := participants[event.UserID]
+		if !ok {
+			p = &participant{
+				record: AttendanceRecord{
+					ParticipantID: event.UserID,
+					Username:      event.Username,
+					FirstJoin:     event.At,
+				},
+				open:    make(map[string]time.Time),
+				present: make(map[string]bool),
+			}
+			participants[event.UserID] = p
+			order = append(order, event.UserID)
+		}
+
+		switch event.Type {
+		case AttendanceJoin:
+			p.present[event.SessionID] = true
+		case AttendanceConnect:
+			p.present[event.SessionID] = true
+			p.open[event.SessionID] = event.At
+			p.connects++
+		case AttendanceDisconnect, AttendanceLeave:
+			if start, ok := p.open[event.SessionID]; ok {
+				p.record.ConnectedDuration += event.At.Sub(start)
+				delete(p.open, event.SessionID)
+			}
+			if event.Type == AttendanceLeave {
+				delete(p.present, event.SessionID)
+			}
+			at := event.At
+			p.record.LastLeave = &at
+		}
+	}
+
+	records := make([]AttendanceRecord, 0, len(order))
+	for _, userID := range order {
+		p := participants[userID]
+		for _, start := range p.open {
+			p.record.ConnectedDuration += now.Sub(start)
+		}
+		if len(p.present) > 0 {
+			p.record.LastLeave = nil
+		}
+		if p.connects > 1 {
+			p.record.Reconnects = p.connects - 1
+		}
+		p.record.ConnectedSeconds = int64(p.record.ConnectedDuration / time.Second)
+		records = append(records, p.record)
+	}
+	return records
+}
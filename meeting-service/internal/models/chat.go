@@ -0,0 +1,132 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ChatMessage is a chat line sent in a meeting room
+type ChatMessage struct {
+	ID            primitive.ObjectID `bson:"_id" json:"id"`
+	RoomID        string             `bson:"room_id" json:"room_id"`
+	SessionID     string             `bson:"session_id" json:"session_id"`
+	ParticipantID primitive.ObjectID `bson:"participant_id,omitempty" json:"participant_id,omitempty"`
+	Username      string             `bson:"username" json:"username"`
+	Content       string             `bson:"content" json:"content"`
+	CreatedAt     time.Time          `bson:"created_at" json:"timestamp"`
+	// Recipient is set on direct messages
+	Recipient *ChatRecipient `bson:"recipient,omitempty" json:"recipient,omitempty"`
+	// VisibleTo limits who sees the message in history, everyone when empty
+	VisibleTo []primitive.ObjectID `bson:"visible_to,omitempty" json:"-"`
+	// ReplyTo is the message this one answers in a thread
+	ReplyTo   *primitive.ObjectID `bson:"reply_to,omitempty" json:"reply_to,omitempty"`
+	EditedAt  *time.Time          `bson:"edited_at,omitempty" json:"edited_at,omitempty"`
+	DeletedAt *time.Time          `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	Reactions []ChatReaction      `bson:"reactions,omitempty" json:"reactions,omitempty"`
+	// Version is bumped on every update to detect concurrent ones
+	Version int `bson:"version" json:"-"`
+}
+
+// ChatReaction is one emoji on a message and who reacted with it
+type ChatReaction struct {
+	Emoji          string               `bson:"emoji" json:"emoji"`
+	Count          int                  `bson:"count" json:"count"`
+	ParticipantIDs []primitive.ObjectID `bson:"participant_ids" json:"participant_ids"`
+}
+
+// ChatRecipient is who a direct message was sent to. SessionID is empty when
+// it was addressed to the participant rather than one of their sessions.
+type ChatRecipient struct {
+	SessionID     string             `bson:"session_id,omitempty" json:"session_id,omitempty"`
+	ParticipantID primitive.ObjectID `bson:"participant_id" json:"participant_id"`
+	Username      string             `bson:"username" json:"username"`
+}
+
+// NewChatMessage creates a message with a fresh ID, IDs increase with time and
+// double as the paging cursor
+func NewChatMessage(roomID, sessionID string, participantID primitive.ObjectID, username, content string) *ChatMessage {
+	return &ChatMessage{
+		ID:            primitive.NewObjectID(),
+		RoomID:        roomID,
+		SessionID:     sessionID,
+		ParticipantID: participantID,
+		Username:      username,
+		Content:       content,
+		CreatedAt:     time.Now(),
+	}
+}
+
+// DirectTo turns the message into a direct message only the sender and the
+// recipient see
+func (m *ChatMessage) DirectTo(recipient ChatRecipient) {
+	m.Recipient = &recipient
+	m.VisibleTo = []primitive.ObjectID{m.ParticipantID, recipient.ParticipantID}
+}
+
+// IsAuthor reports whether the participant wrote the message. Messages from
+// before participant IDs were stored only know the session.
+func (m *ChatMessage) IsAuthor(participantID primitive.ObjectID, sessionID string) bool {
+	if m.ParticipantID.IsZero() {
+		return m.SessionID == sessionID
+	}
+	return m.ParticipantID == participantID
+}
+
+// Edit replaces the content
+func (m *ChatMessage) Edit(content string, now time.Time) {
+	m.Content = content
+	m.EditedAt = &now
+}
+
+// Delete keeps the message as a placeholder so replies still have a parent,
+// its content and reactions are dropped
+func (m *ChatMessage) Delete(now time.Time) {
+	m.Content = ""
+	m.Reactions = nil
+	m.DeletedAt = &now
+}
+
+// ToggleReaction adds the participant's reaction or takes it back, it reports
+// whether the reaction was added
+func (m *ChatMessage) ToggleReaction(emoji string, participantID primitive.ObjectID) bool {
+	for i := range m.Reactions {
+		reaction := &m.Reactions[i]
+		if reaction.Emoji != emoji {
+			continue
+		}
+		for j, id := range reaction.ParticipantIDs {
+			if id == participantID {
+				reaction.ParticipantIDs = append(reaction.ParticipantIDs[:j], reaction.ParticipantIDs[j+1:]...)
+				reaction.Count = len(reaction.ParticipantIDs)
+				if reaction.Count == 0 {
+					m.Reactions = append(m.Reactions[:i], m.Reactions[i+1:]...)
+				}
+				return false
+			}
+		}
+		reaction.ParticipantIDs = append(reaction.ParticipantIDs, participantID)
+		reaction.Count = len(reaction.ParticipantIDs)
+		return true
+	}
+
+	m.Reactions = append(m.Reactions, ChatReaction{
+		Emoji:          emoji,
+		Count:          1,
+		ParticipantIDs: []primitive.ObjectID{participantID},
+	})
+	return true
+}
+
+// IsVisibleTo reports whether the participant may see the message
+func (m *ChatMessage) IsVisibleTo(participantID primitive.ObjectID) bool {
+	if len(m.VisibleTo) == 0 {
+		return true
+	}
+	for _, id := range m.VisibleTo {
+		if id == participantID {
+			return true
+		}
+	}
+	return false
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Session struct {
@@ -11,30 +12,172 @@ type Session struct {
     Username    string             `bson:"username" json:"username"`
     SessionID   string             `bson:"session_id" json:"session_id"`
     CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+    // LastSeenAt is when an instance last saw the session's WebSocket
+    LastSeenAt  time.Time          `bson:"last_seen_at,omitempty" json:"-"`
+    // AudioMids are the mids of the audio tracks the session published
+    AudioMids   []string           `bson:"audio_mids,omitempty" json:"-"`
 }
 
+// LobbyEntry is a join request waiting for a host decision
+type LobbyEntry struct {
+    ID          string             `bson:"id" json:"id"`
+    UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+    Username    string             `bson:"username" json:"username"`
+    Status      string             `bson:"status" json:"status"`
+    // SessionID is set once the request is admitted
+    SessionID   string             `bson:"session_id,omitempty" json:"-"`
+    // PollSecret lets only the requester collect the outcome
+    PollSecret  string             `bson:"poll_secret" json:"-"`
+    RequestedAt time.Time          `bson:"requested_at" json:"requested_at"`
+    // LastPolledAt is when the requester last asked for the outcome
+    LastPolledAt time.Time         `bson:"last_polled_at" json:"-"`
+    // ResolvedAt is when a host admitted or denied the request
+    ResolvedAt  *time.Time         `bson:"resolved_at,omitempty" json:"-"`
+}
+
+// Stale reports whether a resolved entry was resolved before resolvedBefore,
+// or a pending one last polled before abandonedBefore
+func (e *LobbyEntry) Stale(resolvedBefore, abandonedBefore time.Time) bool {
+    if e.Status == LobbyPending {
+        return e.LastPolledAt.Before(abandonedBefore)
+    }
+    return e.ResolvedAt != nil && e.ResolvedAt.Before(resolvedBefore)
+}
+
+// Lobby entry statuses
+const (
+    LobbyPending  = "pending"
+    LobbyAdmitted = "admitted"
+    LobbyDenied   = "denied"
+)
+
+// Participant roles, the creator is always the host
+const (
+    RoleHost        = "host"
+    RoleCoHost      = "co_host"
+    RoleParticipant = "participant"
+)
+
 // Meeting represents a meeting room structure
 type Meeting struct {
-    ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-    RoomID      string             `bson:"room_id" json:"room_id"`
-    Title       string             `bson:"title" json:"title"`
-    Description string             `bson:"description"`
-    CreatorID   primitive.ObjectID `bson:"creator_id" json:"creator_id"`
-    Sessions    []Session          `bson:"sessions" json:"sessions"`
-    CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
-    UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+    ID              primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+    RoomID          string               `bson:"room_id" json:"room_id"`
+    Title           string               `bson:"title" json:"title"`
+    Description     string               `bson:"description"`
+    CreatorID       primitive.ObjectID   `bson:"creator_id" json:"creator_id"`
+    // CreatorName and CreatorEmail identify the organizer in calendar invites
+    CreatorName     string               `bson:"creator_name,omitempty" json:"creator_name,omitempty"`
+    CreatorEmail    string               `bson:"creator_email,omitempty" json:"-"`
+    CoHostIDs       []primitive.ObjectID `bson:"co_host_ids" json:"co_host_ids"`
+    BannedUsernames []string             `bson:"banned_usernames" json:"banned_usernames"`
+    // RevokedParticipantIDs lost their join tokens when they were removed
+    RevokedParticipantIDs []primitive.ObjectID `bson:"revoked_participant_ids,omitempty" json:"-"`
+    LobbyEnabled    bool                 `bson:"lobby_enabled" json:"lobby_enabled"`
+    // PasscodeHash is a bcrypt hash, empty when the meeting has no passcode
+    PasscodeHash    string               `bson:"passcode_hash,omitempty" json:"-"`
+    Locked          bool                 `bson:"locked" json:"locked"`
+    // Schedule is nil for ad-hoc meetings that can be joined at any time
+    Schedule        *Schedule            `bson:"schedule,omitempty" json:"schedule,omitempty"`
+    // EndedAt is set when the host ends the meeting
+    EndedAt         *time.Time           `bson:"ended_at,omitempty" json:"ended_at,omitempty"`
+    Lobby           []LobbyEntry         `bson:"lobby" json:"lobby"`
+    Sessions        []Session            `bson:"sessions" json:"sessions"`
+    CreatedAt       time.Time            `bson:"created_at" json:"created_at"`
+    UpdatedAt       time.Time            `bson:"updated_at" json:"updated_at"`
 }
 
 // NewMeeting creates a new meeting instance
 func NewMeeting(title, description string, creatorID primitive.ObjectID, roomID string) *Meeting {
     now := time.Now()
     return &Meeting{
-        Title:       title,
-        Description: description,
-        RoomID:      roomID,
-        CreatorID:   creatorID,
-        Sessions:    []Session{},
-        CreatedAt:   now,
-        UpdatedAt:   now,
-    }
-}
\ No newline at end of file
+        Title:           title,
+        Description:     description,
+        RoomID:          roomID,
+        CreatorID:       creatorID,
+        CoHostIDs:       []primitive.ObjectID{},
+        BannedUsernames: []string{},
+        Lobby:           []LobbyEntry{},
+        Sessions:        []Session{},
+        CreatedAt:       now,
+        UpdatedAt:       now,
+    }
+}
+
+// RoleOf returns the role of the participant with the given user ID
+func (m *Meeting) RoleOf(userID primitive.ObjectID) string {
+    if userID == m.CreatorID {
+        return RoleHost
+    }
+    for _, id := range m.CoHostIDs {
+        if id == userID {
+            return RoleCoHost
+        }
+    }
+    return RoleParticipant
+}
+
+// IsModerator reports whether the user may mute, remove or ban others
+func (m *Meeting) IsModerator(userID primitive.ObjectID) bool {
+    return m.RoleOf(userID) != RoleParticipant
+}
+
+// IsRevoked reports whether the participant's join tokens were revoked
+func (m *Meeting) IsRevoked(userID primitive.ObjectID) bool {
+    for _, id := range m.RevokedParticipantIDs {
+        if id == userID {
+            return true
+        }
+    }
+    return false
+}
+
+func (m *Meeting) IsBanned(username string) bool {
+    for _, banned := range m.BannedUsernames {
+        if banned == username {
+            return true
+        }
+    }
+    return false
+}
+
+// FindSession returns the session with the given Cloudflare session ID
+func (m *Meeting) FindSession(sessionID string) *Session {
+    for i := range m.Sessions {
+        if m.Sessions[i].SessionID == sessionID {
+            return &m.Sessions[i]
+        }
+    }
+    return nil
+}
+
+// FindLobbyEntry returns the lobby entry with the given request ID
+func (m *Meeting) FindLobbyEntry(requestID string) *LobbyEntry {
+    for i := range m.Lobby {
+        if m.Lobby[i].ID == requestID {
+            return &m.Lobby[i]
+        }
+    }
+    return nil
+}
+
+// SetPasscode stores a bcrypt hash of the passcode, an empty passcode removes it
+func (m *Meeting) SetPasscode(passcode string) error {
+    if passcode == "" {
+        m.PasscodeHash = ""
+        return nil
+    }
+    hash, err := bcrypt.GenerateFromPassword([]byte(passcode), bcrypt.DefaultCost)
+    if err != nil {
+        return err
+    }
+    m.PasscodeHash = string(hash)
+    return nil
+}
+
+// CheckPasscode reports whether passcode opens the meeting
+func (m *Meeting) CheckPasscode(passcode string) bool {
+    if m.PasscodeHash == "" {
+        return true
+    }
+    return bcrypt.CompareHashAndPassword([]byte(m.PasscodeHash), []byte(passcode)) == nil
+}
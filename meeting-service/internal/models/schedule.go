@@ -0,0 +1,290 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Upper bound on generated occurrences, protects against open-ended rules
+const maxRecurrenceIterations = 10000
+
+// Schedule is the planned time of a meeting. Recurrence is an RRULE
+// (RFC 5545) subset: FREQ=DAILY|WEEKLY|MONTHLY with INTERVAL, COUNT, UNTIL
+// and BYDAY for weekly rules. Occurrences are computed in Timezone so a 9:00
+// standup stays at 9:00 across DST changes.
+type Schedule struct {
+	StartTime  time.Time `bson:"start_time" json:"start_time"`
+	EndTime    time.Time `bson:"end_time" json:"end_time"`
+	Timezone   string    `bson:"timezone" json:"timezone"`
+	Recurrence string    `bson:"recurrence,omitempty" json:"recurrence,omitempty"`
+}
+
+// Occurrence is a single instance of a scheduled meeting
+type Occurrence struct {
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+type recurrenceRule struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+	byDay    []time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+var weekdayNames = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Validate checks the times, timezone and recurrence rule
+func (s *Schedule) Validate() error {
+	if s.StartTime.IsZero() || s.EndTime.IsZero() {
+		return errors.New("schedule needs a start and end time")
+	}
+	if !s.EndTime.After(s.StartTime) {
+		return errors.New("schedule end time must be after its start time")
+	}
+	if _, err := s.location(); err != nil {
+		return err
+	}
+	if s.Recurrence != "" {
+		if _, err := parseRecurrence(s.Recurrence, time.UTC); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schedule) location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", s.Timezone)
+	}
+	return loc, nil
+}
+
+// Occurrences returns up to limit occurrences that have not ended before from
+func (s *Schedule) Occurrences(from time.Time, limit int) []Occurrence {
+	occurrences := []Occurrence{}
+	s.each(func(o Occurrence) bool {
+		if o.EndTime.After(from) {
+			occurrences = append(occurrences, o)
+		}
+		return len(occurrences) < limit
+	})
+	return occurrences
+}
+
+// Current returns the first occurrence that has not ended at t, if any
+func (s *Schedule) Current(t time.Time) (Occurrence, bool) {
+	occurrences := s.Occurrences(t, 1)
+	if len(occurrences) == 0 {
+		return Occurrence{}, false
+	}
+	return occurrences[0], true
+}
+
+// each calls fn for every occurrence in order until fn returns false
+func (s *Schedule) each(fn func(Occurrence) bool) {
+	loc, err := s.location()
+	if err != nil {
+		return
+	}
+	duration := s.EndTime.Sub(s.StartTime)
+	start := s.StartTime.In(loc)
+
+	if s.Recurrence == "" {
+		fn(Occurrence{StartTime: start, EndTime: start.Add(duration)})
+		return
+	}
+	rule, err := parseRecurrence(s.Recurrence, loc)
+	if err != nil {
+		return
+	}
+	rule.normalize(start)
+
+	emitted := 0
+	emit := func(t time.Time) bool {
+		if t.Before(start) {
+			return true
+		}
+		if !rule.until.IsZero() && t.After(rule.until) {
+			return false
+		}
+		if rule.count > 0 && emitted >= rule.count {
+			return false
+		}
+		emitted++
+		return fn(Occurrence{StartTime: t, EndTime: t.Add(duration)})
+	}
+
+	hour, min, sec := start.Clock()
+	for period := 0; period < maxRecurrenceIterations; period++ {
+		switch rule.freq {
+		case "DAILY":
+			if !emit(start.AddDate(0, 0, period*rule.interval)) {
+				return
+			}
+		case "WEEKLY":
+			// Days of the period's week, weeks start on Monday as in RFC 5545
+			weekStart := start.AddDate(0, 0, period*rule.interval*7-(int(start.Weekday())+6)%7)
+			for _, day := range rule.byDay {
+				offset := (int(day) + 6) % 7
+				d := time.Date(weekStart.Year(), weekStart.Month(), weekStart.Day()+offset, hour, min, sec, 0, loc)
+				if !emit(d) {
+					return
+				}
+			}
+		case "MONTHLY":
+			month := time.Date(start.Year(), start.Month()+time.Month(period*rule.interval), 1, hour, min, sec, 0, loc)
+			// Months without the start day are skipped
+			d := month.AddDate(0, 0, start.Day()-1)
+			if d.Month() == month.Month() && !emit(d) {
+				return
+			}
+		}
+	}
+}
+
+// parseRecurrence reads value, an UNTIL without a Z suffix is floating time
+// and taken to be in loc
+func parseRecurrence(value string, loc *time.Location) (*recurrenceRule, error) {
+	rule := &recurrenceRule{interval: 1}
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+
+	for _, part := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid recurrence part %q", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.freq = strings.ToUpper(val)
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid recurrence interval %q", val)
+			}
+			rule.interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid recurrence count %q", val)
+			}
+			rule.count = n
+		case "UNTIL":
+			until, err := parseRecurrenceTime(val, loc)
+			if err != nil {
+				return nil, fmt.Errorf("invalid recurrence until %q", val)
+			}
+			rule.until = until
+		case "BYDAY":
+			for _, name := range strings.Split(val, ",") {
+				day, ok := weekdays[strings.ToUpper(name)]
+				if !ok {
+					return nil, fmt.Errorf("invalid recurrence day %q", name)
+				}
+				rule.byDay = append(rule.byDay, day)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported recurrence part %q", key)
+		}
+	}
+
+	switch rule.freq {
+	case "DAILY", "MONTHLY":
+		if len(rule.byDay) > 0 {
+			return nil, errors.New("BYDAY is only supported for weekly recurrences")
+		}
+	case "WEEKLY":
+	default:
+		return nil, fmt.Errorf("unsupported recurrence frequency %q", rule.freq)
+	}
+	return rule, nil
+}
+
+// normalize fills BYDAY for weekly rules and orders days from Monday
+func (r *recurrenceRule) normalize(start time.Time) {
+	if r.freq != "WEEKLY" {
+		return
+	}
+	if len(r.byDay) == 0 {
+		r.byDay = []time.Weekday{start.Weekday()}
+	}
+	days := r.byDay
+	for i := 1; i < len(days); i++ {
+		for j := i; j > 0 && (int(days[j])+6)%7 < (int(days[j-1])+6)%7; j-- {
+			days[j], days[j-1] = days[j-1], days[j]
+		}
+	}
+}
+
+func parseRecurrenceTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return t, nil
+	}
+	// A date includes the occurrences on that day
+	if t, err := time.ParseInLocation("20060102", value, loc); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, errors.New("invalid time")
+}
+
+// RRule renders the recurrence as an RFC 5545 RRULE value, with UNTIL in UTC
+// as required next to a DTSTART with a TZID. Empty when the meeting does not
+// repeat.
+func (s *Schedule) RRule() string {
+	if s.Recurrence == "" {
+		return ""
+	}
+	rule, err := parseRecurrence(s.Recurrence, s.Location())
+	if err != nil {
+		return ""
+	}
+
+	parts := []string{"FREQ=" + rule.freq}
+	if rule.interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(rule.interval))
+	}
+	if rule.count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(rule.count))
+	}
+	if !rule.until.IsZero() {
+		parts = append(parts, "UNTIL="+rule.until.UTC().Format("20060102T150405Z"))
+	}
+	if len(rule.byDay) > 0 {
+		days := make([]string, 0, len(rule.byDay))
+		for _, day := range rule.byDay {
+			days = append(days, weekdayNames[day])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Location returns the schedule's timezone, UTC when it is not set or unknown
+func (s *Schedule) Location() *time.Location {
+	loc, err := s.location()
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
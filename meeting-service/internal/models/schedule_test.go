@@ -0,0 +1,68 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFloatingUntilUsesScheduleTimezone(t *testing.T) {
+	tests := []struct {
+		name       string
+		timezone   string
+		recurrence string
+		want       []string
+	}{
+		{
+			// 09:00 in New York is after 09:00 UTC, read as UTC the last day is dropped
+			name:       "west of UTC keeps the last occurrence",
+			timezone:   "America/New_York",
+			recurrence: "FREQ=DAILY;UNTIL=20260305T090000",
+			want:       []string{"2026-03-02", "2026-03-03", "2026-03-04", "2026-03-05"},
+		},
+		{
+			// 08:00 in Tokyo is before 09:00 there, read as UTC it would allow the 4th
+			name:       "east of UTC adds no occurrence",
+			timezone:   "Asia/Tokyo",
+			recurrence: "FREQ=DAILY;UNTIL=20260304T080000",
+			want:       []string{"2026-03-02", "2026-03-03"},
+		},
+		{
+			name:       "date includes its day",
+			timezone:   "Asia/Tokyo",
+			recurrence: "FREQ=DAILY;UNTIL=20260304",
+			want:       []string{"2026-03-02", "2026-03-03", "2026-03-04"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.timezone)
+			if err != nil {
+				t.Skipf("timezone data unavailable: %v", err)
+			}
+			start := time.Date(2026, 3, 2, 9, 0, 0, 0, loc)
+			schedule := &Schedule{
+				StartTime:  start,
+				EndTime:    start.Add(30 * time.Minute),
+				Timezone:   tt.timezone,
+				Recurrence: tt.recurrence,
+			}
+			if err := schedule.Validate(); err != nil {
+				t.Fatalf("Validate() = %v", err)
+			}
+
+			var got []string
+			for _, o := range schedule.Occurrences(time.Time{}, 10) {
+				got = append(got, o.StartTime.In(loc).Format("2006-01-02"))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("occurrences %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("occurrence %d on %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SpeakerStats is one participant's share of the conversation
+type SpeakerStats struct {
+	SessionID   string  `bson:"session_id" json:"session_id"`
+	Username    string  `bson:"username" json:"username"`
+	TalkSeconds float64 `bson:"talk_seconds" json:"talk_seconds"`
+	// LongestMonologueSeconds is the longest uninterrupted speaking stretch
+	LongestMonologueSeconds float64 `bson:"longest_monologue_seconds" json:"longest_monologue_seconds"`
+	// Interruptions counts starting to speak while someone else was speaking,
+	// Interrupted counts being talked over
+	Interruptions int  `bson:"interruptions" json:"interruptions"`
+	Interrupted   int  `bson:"interrupted" json:"interrupted"`
+	Speaking      bool `bson:"-" json:"speaking"`
+}
+
+// SpeakingSummary is stored when the last participant leaves a room
+type SpeakingSummary struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	RoomID       string             `bson:"room_id" json:"room_id"`
+	StartedAt    time.Time          `bson:"started_at" json:"started_at"`
+	EndedAt      time.Time          `bson:"ended_at" json:"ended_at"`
+	Participants []SpeakerStats     `bson:"participants" json:"participants"`
+}
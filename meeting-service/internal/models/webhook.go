@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook lifecycle events
+const (
+	EventMeetingCreated    = "meeting.created"
+	EventParticipantJoined = "participant.joined"
+	EventParticipantLeft   = "participant.left"
+	EventRoomEmpty         = "room.empty"
+	EventMeetingEnded      = "meeting.ended"
+)
+
+// WebhookEvents lists every event a webhook can subscribe to
+var WebhookEvents = []string{
+	EventMeetingCreated,
+	EventParticipantJoined,
+	EventParticipantLeft,
+	EventRoomEmpty,
+	EventMeetingEnded,
+}
+
+// Webhook is an endpoint registered by a meeting host
+type Webhook struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	RoomID string             `bson:"room_id" json:"room_id"`
+	URL    string             `bson:"url" json:"url"`
+	// Events the endpoint receives, all events when empty
+	Events []string `bson:"events" json:"events"`
+	// Secret signs the payloads, it is only returned when the webhook is created
+	Secret    string    `bson:"secret" json:"-"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// Wants reports whether the webhook subscribed to event
+func (w *Webhook) Wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one payload queued for one endpoint. It carries the URL
+// and secret so deliveries survive the webhook being deleted.
+type WebhookDelivery struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	WebhookID     primitive.ObjectID `bson:"webhook_id,omitempty" json:"webhook_id,omitempty"`
+	RoomID        string             `bson:"room_id" json:"room_id"`
+	URL           string             `bson:"url" json:"url"`
+	Secret        string             `bson:"secret" json:"-"`
+	Event         string             `bson:"event" json:"event"`
+	Payload       []byte             `bson:"payload" json:"-"`
+	Status        string             `bson:"status" json:"status"`
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	LastError     string             `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at" json:"next_attempt_at"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+}
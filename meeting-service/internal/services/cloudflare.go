@@ -2,15 +2,26 @@ package services
 
 import (
     "bytes"
+    "context"
     "encoding/json"
     "fmt"
+    "io"
     "net/http"
+    "time"
+
+    "meeting-service/internal/metrics"
 )
 
+// Longest a single Calls API request may take, a hung call would otherwise
+// block the participant's track setup for good
+const cloudflareTimeout = 10 * time.Second
+
 type CloudflareService struct {
     AppID    string
     AppToken string
     BaseURL  string
+    // Client is shared by every request
+    Client *http.Client
 }
 
 func NewCloudflareService(appID, appToken string) *CloudflareService {
@@ -18,41 +29,218 @@ func NewCloudflareService(appID, appToken string) *CloudflareService {
         AppID:    appID,
         AppToken: appToken,
         BaseURL:  fmt.Sprintf("https://rtc.live.cloudflare.com/v1/apps/%s", appID),
+        Client:   &http.Client{Timeout: cloudflareTimeout},
     }
 }
 
-type SessionResponse struct {
-    SessionID        string `json:"sessionId"`
-    ErrorCode       int    `json:"errorCode,omitempty"`
+// SessionDescription is an SDP offer or answer exchanged with Cloudflare Calls
+type SessionDescription struct {
+    SDP  string `json:"sdp"`
+    Type string `json:"type"`
+}
+
+// TrackError is the per-track error returned by tracks/new and tracks/close
+type TrackError struct {
+    ErrorCode        string `json:"errorCode,omitempty"`
     ErrorDescription string `json:"errorDescription,omitempty"`
 }
 
-func (s *CloudflareService) CreateSession() (string, error) {
-    url := fmt.Sprintf("%s/sessions/new", s.BaseURL)
-    
-    req, err := http.NewRequest("POST", url, bytes.NewBuffer([]byte{}))
+type TrackObject struct {
+    Location  string      `json:"location,omitempty"`
+    Mid       string      `json:"mid,omitempty"`
+    SessionID string      `json:"sessionId,omitempty"`
+    TrackName string      `json:"trackName,omitempty"`
+    Status    string      `json:"status,omitempty"`
+    Error     *TrackError `json:"error,omitempty"`
+}
+
+type TracksRequest struct {
+    SessionDescription *SessionDescription `json:"sessionDescription,omitempty"`
+    Tracks             []TrackObject       `json:"tracks"`
+}
+
+type TracksResponse struct {
+    RequiresImmediateRenegotiation bool                `json:"requiresImmediateRenegotiation"`
+    SessionDescription             *SessionDescription `json:"sessionDescription,omitempty"`
+    Tracks                         []TrackObject       `json:"tracks"`
+}
+
+type RenegotiateRequest struct {
+    SessionDescription SessionDescription `json:"sessionDescription"`
+}
+
+type CloseTrackObject struct {
+    Mid   string      `json:"mid"`
+    Error *TrackError `json:"error,omitempty"`
+}
+
+type CloseTracksRequest struct {
+    SessionDescription *SessionDescription `json:"sessionDescription,omitempty"`
+    Tracks             []CloseTrackObject  `json:"tracks"`
+    Force              bool                `json:"force"`
+}
+
+type CloseTracksResponse struct {
+    RequiresImmediateRenegotiation bool                `json:"requiresImmediateRenegotiation"`
+    SessionDescription             *SessionDescription `json:"sessionDescription,omitempty"`
+    Tracks                         []CloseTrackObject  `json:"tracks"`
+}
+
+type SessionStateResponse struct {
+    Tracks []TrackObject `json:"tracks"`
+}
+
+type SessionResponse struct {
+    SessionID string `json:"sessionId"`
+}
+
+// APIError is a top level error reported by Cloudflare Calls. ErrorCode is kept
+// as raw JSON because the API has returned it both as a number and a string.
+type APIError struct {
+    StatusCode       int             `json:"-"`
+    ErrorCode        json.RawMessage `json:"errorCode,omitempty"`
+    ErrorDescription string          `json:"errorDescription,omitempty"`
+}
+
+func (e *APIError) Error() string {
+    return fmt.Sprintf("cloudflare error: %s", e.ErrorDescription)
+}
+
+func (e *APIError) hasError() bool {
+    code := string(e.ErrorCode)
+    return (code != "" && code != "null" && code != `""`) || e.ErrorDescription != ""
+}
+
+func (s *CloudflareService) CreateSession(ctx context.Context) (string, error) {
+    var sessionResp SessionResponse
+    if err := s.do(ctx, "create_session", "POST", "/sessions/new", nil, &sessionResp); err != nil {
+        return "", err
+    }
+
+    return sessionResp.SessionID, nil
+}
+
+// AddTracks publishes local tracks or pulls remote tracks into a session
+func (s *CloudflareService) AddTracks(ctx context.Context, sessionID string, tracksReq *TracksRequest) (*TracksResponse, error) {
+    var tracksResp TracksResponse
+    if err := s.do(ctx, "add_tracks", "POST", fmt.Sprintf("/sessions/%s/tracks/new", sessionID), tracksReq, &tracksResp); err != nil {
+        return nil, err
+    }
+
+    return &tracksResp, nil
+}
+
+// Renegotiate sends the client's answer after requiresImmediateRenegotiation
+func (s *CloudflareService) Renegotiate(ctx context.Context, sessionID string, renegotiateReq *RenegotiateRequest) (*SessionDescription, error) {
+    var description SessionDescription
+    if err := s.do(ctx, "renegotiate", "PUT", fmt.Sprintf("/sessions/%s/renegotiate", sessionID), renegotiateReq, &description); err != nil {
+        return nil, err
+    }
+
+    return &description, nil
+}
+
+// CloseTracks closes local or remote tracks by transceiver mid
+func (s *CloudflareService) CloseTracks(ctx context.Context, sessionID string, closeReq *CloseTracksRequest) (*CloseTracksResponse, error) {
+    var closeResp CloseTracksResponse
+    if err := s.do(ctx, "close_tracks", "PUT", fmt.Sprintf("/sessions/%s/tracks/close", sessionID), closeReq, &closeResp); err != nil {
+        return nil, err
+    }
+
+    return &closeResp, nil
+}
+
+// GetSessionState returns the tracks currently associated with a session
+func (s *CloudflareService) GetSessionState(ctx context.Context, sessionID string) (*SessionStateResponse, error) {
+    var stateResp SessionStateResponse
+    if err := s.do(ctx, "session_state", "GET", fmt.Sprintf("/sessions/%s", sessionID), nil, &stateResp); err != nil {
+        return nil, err
+    }
+
+    return &stateResp, nil
+}
+
+// Ping checks that the Calls API is reachable and accepts our token. Any
+// answer other than a server error or an auth failure counts as reachable.
+func (s *CloudflareService) Ping(ctx context.Context) (err error) {
+    start := time.Now()
+    defer func() {
+        metrics.ObserveCloudflare("ping", time.Since(start), err)
+    }()
+
+    req, err := http.NewRequestWithContext(ctx, "GET", s.BaseURL, nil)
     if err != nil {
-        return "", fmt.Errorf("failed to create request: %v", err)
+        return fmt.Errorf("failed to create request: %v", err)
+    }
+    req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.AppToken))
+
+    resp, err := s.Client.Do(req)
+    if err != nil {
+        return fmt.Errorf("failed to send request: %v", err)
+    }
+    defer resp.Body.Close()
+    io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+    if resp.StatusCode >= 500 || resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+        return &APIError{StatusCode: resp.StatusCode, ErrorDescription: http.StatusText(resp.StatusCode)}
+    }
+    return nil
+}
+
+// do calls the API and records its latency and errors under operation
+func (s *CloudflareService) do(ctx context.Context, operation, method, path string, body interface{}, out interface{}) (err error) {
+    start := time.Now()
+    defer func() {
+        metrics.ObserveCloudflare(operation, time.Since(start), err)
+    }()
+
+    payload := []byte{}
+    if body != nil {
+        var err error
+        payload, err = json.Marshal(body)
+        if err != nil {
+            return fmt.Errorf("failed to encode request: %v", err)
+        }
+    }
+
+    req, err := http.NewRequestWithContext(ctx, method, s.BaseURL+path, bytes.NewBuffer(payload))
+    if err != nil {
+        return fmt.Errorf("failed to create request: %v", err)
     }
 
     req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.AppToken))
     req.Header.Set("Content-Type", "application/json")
 
-    client := &http.Client{}
-    resp, err := client.Do(req)
+    resp, err := s.Client.Do(req)
     if err != nil {
-        return "", fmt.Errorf("failed to send request: %v", err)
+        return fmt.Errorf("failed to send request: %v", err)
     }
     defer resp.Body.Close()
 
-    var sessionResp SessionResponse
-    if err := json.NewDecoder(resp.Body).Decode(&sessionResp); err != nil {
-        return "", fmt.Errorf("failed to decode response: %v", err)
+    respBody, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return fmt.Errorf("failed to read response: %v", err)
     }
 
-    if sessionResp.ErrorCode != 0 {
-        return "", fmt.Errorf("cloudflare error: %s", sessionResp.ErrorDescription)
+    apiErr := &APIError{StatusCode: resp.StatusCode}
+    if len(respBody) > 0 {
+        if err := json.Unmarshal(respBody, apiErr); err != nil && resp.StatusCode < 300 {
+            return fmt.Errorf("failed to decode response: %v", err)
+        }
+    }
+    if resp.StatusCode >= 300 || apiErr.hasError() {
+        if apiErr.ErrorDescription == "" {
+            apiErr.ErrorDescription = http.StatusText(resp.StatusCode)
+        }
+        return apiErr
     }
 
-    return sessionResp.SessionID, nil
+    if len(respBody) == 0 {
+        return nil
+    }
+    if err := json.Unmarshal(respBody, out); err != nil {
+        return fmt.Errorf("failed to decode response: %v", err)
+    }
+
+    return nil
 }
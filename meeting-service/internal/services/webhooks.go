@@ -0,0 +1,404 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"meeting-service/internal/models"
+	"meeting-service/internal/store"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// How often the queue is checked for due deliveries
+	webhookPollInterval = time.Second
+	// A claimed delivery is hidden from other workers for this long
+	webhookClaimLease = time.Minute
+	webhookTimeout    = 10 * time.Second
+	// Retries wait webhookBaseBackoff, then twice as long each time up to the max
+	webhookBaseBackoff = 5 * time.Second
+	webhookMaxBackoff  = time.Hour
+	// Deliveries in flight at once, a slow endpoint holds up only one of them
+	webhookWorkers = 8
+)
+
+// ErrInvalidWebhook is returned for registrations with a bad URL or event
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// errPrivateAddress is returned when a meeting's endpoint resolves to an
+// address that is not reachable from the internet
+var errPrivateAddress = errors.New("webhook endpoint is not a public address")
+
+// Ranges that are not covered by the netip helpers but are not public either
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// WebhookPayload is the JSON body posted to webhook endpoints
+type WebhookPayload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	RoomID    string      `json:"room_id"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookService queues lifecycle events for registered endpoints and
+// delivers them in the background, retrying failed deliveries
+type WebhookService struct {
+	store  store.WebhookStore
+	global []models.Webhook
+	// client delivers to the operator's global endpoints, publicClient to the
+	// endpoints meetings registered and refuses to dial non-public addresses
+	client       *http.Client
+	publicClient *http.Client
+	maxAttempts  int
+	wake         chan struct{}
+	logger       *slog.Logger
+}
+
+// NewWebhookService creates the service, global endpoints receive the events
+// of every meeting
+func NewWebhookService(webhookStore store.WebhookStore, global []models.Webhook, maxAttempts int, logger *slog.Logger) *WebhookService {
+	if maxAttempts <= 0 {
+		maxAttempts = 8
+	}
+	return &WebhookService{
+		store:        webhookStore,
+		global:       global,
+		client:       &http.Client{Timeout: webhookTimeout},
+		publicClient: newPublicClient(),
+		maxAttempts:  maxAttempts,
+		wake:         make(chan struct{}, 1),
+		logger:       logger.With("component", "webhooks"),
+	}
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>", receivers
+// recompute it to check the payload came from us and was not replayed
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Emit queues event for every global and room endpoint that subscribed to it
+func (s *WebhookService) Emit(roomID, event string, data interface{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	logger := s.logger.With("room_id", roomID, "event", event)
+	roomWebhooks, err := s.store.ListWebhooks(ctx, roomID)
+	if err != nil {
+		logger.Error("Error listing webhooks", "error", err)
+	}
+	endpoints := append(append([]models.Webhook{}, s.global...), roomWebhooks...)
+
+	var payload []byte
+	queued := false
+	now := time.Now()
+	for _, endpoint := range endpoints {
+		if !endpoint.Wants(event) {
+			continue
+		}
+
+		if payload == nil {
+			payload, err = json.Marshal(WebhookPayload{
+				ID:        uuid.New().String(),
+				Event:     event,
+				RoomID:    roomID,
+				Timestamp: now,
+				Data:      data,
+			})
+			if err != nil {
+				logger.Error("Error encoding webhook", "error", err)
+				return
+			}
+		}
+
+		err := s.store.EnqueueDelivery(ctx, &models.WebhookDelivery{
+			WebhookID:     endpoint.ID,
+			RoomID:        roomID,
+			URL:           endpoint.URL,
+			Secret:        endpoint.Secret,
+			Event:         event,
+			Payload:       payload,
+			Status:        models.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+		if err != nil {
+			logger.Error("Error queueing webhook", "url", endpoint.URL, "error", err)
+			continue
+		}
+		queued = true
+	}
+
+	if queued {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run delivers queued webhooks on a pool of workers until ctx is done
+func (s *WebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	idle := make(chan struct{}, webhookWorkers)
+
+	for {
+		for ctx.Err() == nil {
+			// Only claim a delivery once a worker is free, its lease would
+			// otherwise run out while it waits
+			select {
+			case idle <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			delivery, err := s.store.ClaimDelivery(ctx, time.Now(), webhookClaimLease)
+			if err != nil || delivery == nil {
+				<-idle
+				if err != nil {
+					s.logger.Error("Error claiming webhook delivery", "error", err)
+				}
+				break
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-idle }()
+				s.deliver(ctx, delivery)
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	logger := s.logger.With(
+		"room_id", delivery.RoomID,
+		"event", delivery.Event,
+		"delivery_id", delivery.ID.Hex(),
+		"url", delivery.URL,
+	)
+
+	delivery.Attempts++
+	err := s.post(ctx, delivery)
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = ""
+	case delivery.Attempts >= s.maxAttempts:
+		logger.Warn("Giving up on webhook", "attempts", delivery.Attempts, "error", err)
+		delivery.Status = models.DeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		logger.Debug("Webhook delivery failed, retrying", "attempts", delivery.Attempts, "error", err)
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = time.Now().Add(webhookBackoff(delivery.Attempts))
+	}
+
+	if err := s.store.UpdateDelivery(context.Background(), delivery); err != nil {
+		logger.Error("Error updating webhook delivery", "error", err)
+	}
+}
+
+func (s *WebhookService) post(ctx context.Context, delivery *models.WebhookDelivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", delivery.ID.Hex())
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	if delivery.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", "sha256="+SignWebhook(delivery.Secret, timestamp, delivery.Payload))
+	}
+
+	// Only the operator's global endpoints come without a webhook ID
+	client := s.publicClient
+	if delivery.WebhookID.IsZero() {
+		client = s.client
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// webhookBackoff is the delay before the next attempt after attempts failures
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookBaseBackoff
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookMaxBackoff {
+		backoff = webhookMaxBackoff
+	}
+	return backoff
+}
+
+// Register adds an endpoint for a meeting, the returned webhook carries the
+// generated signing secret
+func (s *WebhookService) Register(ctx context.Context, roomID, rawURL string, events []string) (*models.Webhook, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return nil, ErrInvalidWebhook
+	}
+	if err := checkPublicHost(ctx, target.Hostname()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	for _, event := range events {
+		if !isWebhookEvent(event) {
+			return nil, fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	webhook := &models.Webhook{
+		RoomID:    roomID,
+		URL:       target.String(),
+		Events:    append([]string{}, events...),
+		Secret:    hex.EncodeToString(secret),
+		CreatedAt: time.Now(),
+	}
+	if err := s.store.CreateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *WebhookService) List(ctx context.Context, roomID string) ([]models.Webhook, error) {
+	return s.store.ListWebhooks(ctx, roomID)
+}
+
+func (s *WebhookService) Delete(ctx context.Context, roomID string, id primitive.ObjectID) error {
+	return s.store.DeleteWebhook(ctx, roomID, id)
+}
+
+func isWebhookEvent(event string) bool {
+	for _, e := range models.WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// newPublicClient is an HTTP client that refuses to connect to non-public
+// addresses. The check runs on the resolved address of every dial, so it also
+// holds for redirects and hosts that resolve differently after registration.
+func newPublicClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(addrPort.Addr()) {
+				return errPrivateAddress
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialed instead of the endpoint and defeat the check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: webhookTimeout, Transport: transport}
+}
+
+// checkPublicHost resolves host and fails unless every address is public
+func checkPublicHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !isPublicAddr(addr) {
+			return errPrivateAddress
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if !isPublicAddr(addr) {
+			return errPrivateAddress
+		}
+	}
+	return nil
+}
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
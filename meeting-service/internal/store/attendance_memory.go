@@ -0,0 +1,39 @@
+package store
+
+import (
+	"context"
+	"meeting-service/internal/models"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryAttendanceStore keeps attendance events per room in insertion order
+type MemoryAttendanceStore struct {
+	mu     sync.RWMutex
+	events map[string][]models.AttendanceEvent
+}
+
+func NewMemoryAttendanceStore() *MemoryAttendanceStore {
+	return &MemoryAttendanceStore{
+		events: make(map[string][]models.AttendanceEvent),
+	}
+}
+
+func (s *MemoryAttendanceStore) RecordAttendance(ctx context.Context, event *models.AttendanceEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+	s.events[event.RoomID] = append(s.events[event.RoomID], *event)
+	return nil
+}
+
+func (s *MemoryAttendanceStore) ListAttendance(ctx context.Context, roomID string) ([]models.AttendanceEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]models.AttendanceEvent{}, s.events[roomID]...), nil
+}
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"meeting-service/internal/database"
+	"meeting-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoAttendanceStore struct{}
+
+// NewMongoAttendanceStore indexes the events in the order ListAttendance
+// reads them
+func NewMongoAttendanceStore(ctx context.Context) (*MongoAttendanceStore, error) {
+	s := &MongoAttendanceStore{}
+	err := createIndexes(ctx, s.events(), mongo.IndexModel{
+		Keys: bson.D{{Key: "room_id", Value: 1}, {Key: "at", Value: 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *MongoAttendanceStore) events() *mongo.Collection {
+	return database.GetCollection("attendance_events")
+}
+
+func (s *MongoAttendanceStore) RecordAttendance(ctx context.Context, event *models.AttendanceEvent) error {
+	_, err := s.events().InsertOne(ctx, event)
+	return err
+}
+
+func (s *MongoAttendanceStore) ListAttendance(ctx context.Context, roomID string) ([]models.AttendanceEvent, error) {
+	cursor, err := s.events().Find(
+		ctx,
+		bson.M{"room_id": roomID},
+		options.Find().SetSort(bson.D{{Key: "at", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []models.AttendanceEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
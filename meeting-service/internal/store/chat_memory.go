@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"meeting-service/internal/models"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryChatStore keeps chat messages per room in insertion order
+type MemoryChatStore struct {
+	mu       sync.RWMutex
+	messages map[string][]models.ChatMessage
+}
+
+func NewMemoryChatStore() *MemoryChatStore {
+	return &MemoryChatStore{
+		messages: make(map[string][]models.ChatMessage),
+	}
+}
+
+func (s *MemoryChatStore) SaveChatMessage(ctx context.Context, message *models.ChatMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages[message.RoomID] = append(s.messages[message.RoomID], *message)
+	return nil
+}
+
+func (s *MemoryChatStore) ListChatMessages(ctx context.Context, roomID string, viewer, before primitive.ObjectID, limit int) ([]models.ChatMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var all []models.ChatMessage
+	for _, message := range s.messages[roomID] {
+		if message.IsVisibleTo(viewer) {
+			all = append(all, message)
+		}
+	}
+	end := len(all)
+	if !before.IsZero() {
+		end = 0
+		for end < len(all) && all[end].ID.Hex() < before.Hex() {
+			end++
+		}
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+
+	return append([]models.ChatMessage{}, all[start:end]...), nil
+}
+
+func (s *MemoryChatStore) GetChatMessage(ctx context.Context, roomID string, id primitive.ObjectID) (*models.ChatMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, message := range s.messages[roomID] {
+		if message.ID == id {
+			return &message, nil
+		}
+	}
+	return nil, ErrChatNotFound
+}
+
+func (s *MemoryChatStore) UpdateChatMessage(ctx context.Context, roomID string, id primitive.ObjectID, update func(message *models.ChatMessage) error) (*models.ChatMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := s.messages[roomID]
+	for i := range messages {
+		if messages[i].ID != id {
+			continue
+		}
+		message := messages[i]
+		// Don't share slices with the stored copy
+		message.Reactions = cloneReactions(message.Reactions)
+		if err := update(&message); err != nil {
+			return nil, err
+		}
+		message.Version++
+		messages[i] = message
+
+		updated := message
+		updated.Reactions = cloneReactions(message.Reactions)
+		return &updated, nil
+	}
+	return nil, ErrChatNotFound
+}
+
+func cloneReactions(reactions []models.ChatReaction) []models.ChatReaction {
+	if reactions == nil {
+		return nil
+	}
+	clone := make([]models.ChatReaction, len(reactions))
+	for i, reaction := range reactions {
+		clone[i] = reaction
+		clone[i].ParticipantIDs = append([]primitive.ObjectID{}, reaction.ParticipantIDs...)
+	}
+	return clone
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"meeting-service/internal/database"
+	"meeting-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoChatStore struct{}
+
+// NewMongoChatStore indexes the messages for ListChatMessages, room_state
+// and every history page read a room's newest messages first
+func NewMongoChatStore(ctx context.Context) (*MongoChatStore, error) {
+	s := &MongoChatStore{}
+	err := createIndexes(ctx, s.messages(), mongo.IndexModel{
+		Keys: bson.D{{Key: "room_id", Value: 1}, {Key: "_id", Value: -1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *MongoChatStore) messages() *mongo.Collection {
+	return database.GetCollection("chat_messages")
+}
+
+func (s *MongoChatStore) SaveChatMessage(ctx context.Context, message *models.ChatMessage) error {
+	_, err := s.messages().InsertOne(ctx, message)
+	return err
+}
+
+func (s *MongoChatStore) ListChatMessages(ctx context.Context, roomID string, viewer, before primitive.ObjectID, limit int) ([]models.ChatMessage, error) {
+	filter := bson.M{
+		"room_id": roomID,
+		// Room messages have no visible_to, direct ones list both participants
+		"$or": bson.A{
+			bson.M{"visible_to": bson.M{"$exists": false}},
+			bson.M{"visible_to": viewer},
+		},
+	}
+	if !before.IsZero() {
+		filter["_id"] = bson.M{"$lt": before}
+	}
+
+	// Newest first to apply the limit, reversed below
+	cursor, err := s.messages().Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.M{"_id": -1}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []models.ChatMessage{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+func (s *MongoChatStore) GetChatMessage(ctx context.Context, roomID string, id primitive.ObjectID) (*models.ChatMessage, error) {
+	var message models.ChatMessage
+	err := s.messages().FindOne(ctx, bson.M{"_id": id, "room_id": roomID}).Decode(&message)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrChatNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// Optimistic updates give up after this many concurrent changes
+const chatUpdateAttempts = 5
+
+func (s *MongoChatStore) UpdateChatMessage(ctx context.Context, roomID string, id primitive.ObjectID, update func(message *models.ChatMessage) error) (*models.ChatMessage, error) {
+	for attempt := 0; attempt < chatUpdateAttempts; attempt++ {
+		message, err := s.GetChatMessage(ctx, roomID, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := update(message); err != nil {
+			return nil, err
+		}
+
+		// Messages saved before versioning have no version field
+		version := interface{}(message.Version)
+		if message.Version == 0 {
+			version = bson.M{"$in": bson.A{0, nil}}
+		}
+		message.Version++
+
+		result, err := s.messages().ReplaceOne(ctx, bson.M{"_id": id, "version": version}, message)
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 1 {
+			return message, nil
+		}
+	}
+	return nil, ErrChatConflict
+}
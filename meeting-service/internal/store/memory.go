@@ -0,0 +1,430 @@
+package store
+
+import (
+	"context"
+	"meeting-service/internal/models"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryMeetingStore keeps meetings in process memory. Meetings are copied on
+// the way in and out so callers never share state with the store.
+type MemoryMeetingStore struct {
+	mu       sync.RWMutex
+	meetings map[string]*models.Meeting
+	watchers map[string]map[chan MeetingChange]struct{}
+}
+
+func NewMemoryMeetingStore() *MemoryMeetingStore {
+	return &MemoryMeetingStore{
+		meetings: make(map[string]*models.Meeting),
+		watchers: make(map[string]map[chan MeetingChange]struct{}),
+	}
+}
+
+// cloneMeeting copies the slices so the result can be changed freely. Empty
+// slices stay non-nil to encode as [] like documents read from MongoDB.
+func cloneMeeting(meeting *models.Meeting) *models.Meeting {
+	clone := *meeting
+	clone.Sessions = append(make([]models.Session, 0, len(meeting.Sessions)), meeting.Sessions...)
+	clone.CoHostIDs = append(make([]primitive.ObjectID, 0, len(meeting.CoHostIDs)), meeting.CoHostIDs...)
+	clone.BannedUsernames = append(make([]string, 0, len(meeting.BannedUsernames)), meeting.BannedUsernames...)
+	clone.RevokedParticipantIDs = append([]primitive.ObjectID(nil), meeting.RevokedParticipantIDs...)
+	clone.Lobby = append(make([]models.LobbyEntry, 0, len(meeting.Lobby)), meeting.Lobby...)
+	if meeting.Schedule != nil {
+		schedule := *meeting.Schedule
+		clone.Schedule = &schedule
+	}
+	if meeting.EndedAt != nil {
+		endedAt := *meeting.EndedAt
+		clone.EndedAt = &endedAt
+	}
+	return &clone
+}
+
+func (s *MemoryMeetingStore) CreateMeeting(ctx context.Context, meeting *models.Meeting) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if meeting.ID.IsZero() {
+		meeting.ID = primitive.NewObjectID()
+	}
+	s.meetings[meeting.RoomID] = cloneMeeting(meeting)
+	return nil
+}
+
+func (s *MemoryMeetingStore) GetMeetingByRoom(ctx context.Context, roomID string) (*models.Meeting, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return nil, ErrMeetingNotFound
+	}
+	return cloneMeeting(meeting), nil
+}
+
+func (s *MemoryMeetingStore) ListMeetingsByCreator(ctx context.Context, creatorID primitive.ObjectID) ([]models.Meeting, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	meetings := []models.Meeting{}
+	for _, meeting := range s.meetings {
+		if meeting.CreatorID == creatorID {
+			meetings = append(meetings, *cloneMeeting(meeting))
+		}
+	}
+	sort.Slice(meetings, func(i, j int) bool {
+		return meetings[i].CreatedAt.Before(meetings[j].CreatedAt)
+	})
+	return meetings, nil
+}
+
+func (s *MemoryMeetingStore) UpdateMeeting(ctx context.Context, meeting *models.Meeting) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.meetings[meeting.RoomID]; !ok {
+		return ErrMeetingNotFound
+	}
+	meeting.UpdatedAt = time.Now()
+	s.meetings[meeting.RoomID] = cloneMeeting(meeting)
+	s.notifyLocked(meeting.RoomID)
+	return nil
+}
+
+func (s *MemoryMeetingStore) AddSession(ctx context.Context, roomID string, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return ErrMeetingNotFound
+	}
+	meeting.Sessions = append(meeting.Sessions, session)
+	meeting.UpdatedAt = time.Now()
+	s.notifyLocked(roomID)
+	return nil
+}
+
+func (s *MemoryMeetingStore) RemoveSession(ctx context.Context, roomID string, sessionID string) (*models.Session, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return nil, false, ErrSessionNotFound
+	}
+	for i, session := range meeting.Sessions {
+		if session.SessionID == sessionID {
+			meeting.Sessions = append(meeting.Sessions[:i:i], meeting.Sessions[i+1:]...)
+			meeting.UpdatedAt = time.Now()
+			s.notifyLocked(roomID)
+			return &session, len(meeting.Sessions) == 0, nil
+		}
+	}
+	return nil, false, ErrSessionNotFound
+}
+
+func (s *MemoryMeetingStore) TouchSessions(ctx context.Context, roomID string, sessionIDs []string, seenAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return nil
+	}
+	for i := range meeting.Sessions {
+		for _, id := range sessionIDs {
+			if meeting.Sessions[i].SessionID == id {
+				meeting.Sessions[i].LastSeenAt = seenAt
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MemoryMeetingStore) AddAudioMids(ctx context.Context, roomID string, sessionID string, mids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	session := meeting.FindSession(sessionID)
+	if session == nil {
+		return ErrSessionNotFound
+	}
+	for _, mid := range mids {
+		if !slices.Contains(session.AudioMids, mid) {
+			session.AudioMids = append(session.AudioMids, mid)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryMeetingStore) EndMeeting(ctx context.Context, roomID string, endedAt time.Time) (*models.Meeting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return nil, ErrMeetingNotFound
+	}
+	before := cloneMeeting(meeting)
+	meeting.EndedAt = &endedAt
+	meeting.Sessions = []models.Session{}
+	meeting.Lobby = []models.LobbyEntry{}
+	meeting.UpdatedAt = endedAt
+	s.notifyLocked(roomID)
+	return before, nil
+}
+
+func (s *MemoryMeetingStore) ListActiveMeetings(ctx context.Context) ([]models.Meeting, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	meetings := []models.Meeting{}
+	for _, meeting := range s.meetings {
+		if len(meeting.Sessions) > 0 {
+			meetings = append(meetings, *cloneMeeting(meeting))
+		}
+	}
+	return meetings, nil
+}
+
+func (s *MemoryMeetingStore) ListIdleMeetings(ctx context.Context, before time.Time) ([]models.Meeting, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	meetings := []models.Meeting{}
+	for _, meeting := range s.meetings {
+		if len(meeting.Sessions) == 0 && meeting.UpdatedAt.Before(before) {
+			meetings = append(meetings, *cloneMeeting(meeting))
+		}
+	}
+	return meetings, nil
+}
+
+// ArchiveMeeting drops the meeting, the memory store keeps no archive
+func (s *MemoryMeetingStore) ArchiveMeeting(ctx context.Context, roomID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return ErrMeetingNotFound
+	}
+	if len(meeting.Sessions) == 0 {
+		delete(s.meetings, roomID)
+	}
+	return nil
+}
+
+func (s *MemoryMeetingStore) AddCoHost(ctx context.Context, roomID string, userID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return ErrMeetingNotFound
+	}
+	for _, id := range meeting.CoHostIDs {
+		if id == userID {
+			return nil
+		}
+	}
+	meeting.CoHostIDs = append(meeting.CoHostIDs, userID)
+	meeting.UpdatedAt = time.Now()
+	s.notifyLocked(roomID)
+	return nil
+}
+
+func (s *MemoryMeetingStore) BanUsername(ctx context.Context, roomID string, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return ErrMeetingNotFound
+	}
+	if meeting.IsBanned(username) {
+		return nil
+	}
+	meeting.BannedUsernames = append(meeting.BannedUsernames, username)
+	meeting.UpdatedAt = time.Now()
+	s.notifyLocked(roomID)
+	return nil
+}
+
+func (s *MemoryMeetingStore) RevokeParticipant(ctx context.Context, roomID string, userID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return ErrMeetingNotFound
+	}
+	if meeting.IsRevoked(userID) {
+		return nil
+	}
+	meeting.RevokedParticipantIDs = append(meeting.RevokedParticipantIDs, userID)
+	meeting.UpdatedAt = time.Now()
+	s.notifyLocked(roomID)
+	return nil
+}
+
+func (s *MemoryMeetingStore) SetLocked(ctx context.Context, roomID string, locked bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return ErrMeetingNotFound
+	}
+	meeting.Locked = locked
+	meeting.UpdatedAt = time.Now()
+	s.notifyLocked(roomID)
+	return nil
+}
+
+func (s *MemoryMeetingStore) AddLobbyEntry(ctx context.Context, roomID string, entry models.LobbyEntry, maxPending int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return ErrMeetingNotFound
+	}
+	if err := lobbyRefusal(meeting, entry.Username, maxPending); err != nil {
+		return err
+	}
+	meeting.Lobby = append(meeting.Lobby, entry)
+	meeting.UpdatedAt = time.Now()
+	s.notifyLocked(roomID)
+	return nil
+}
+
+func (s *MemoryMeetingStore) UpdateLobbyEntry(ctx context.Context, roomID string, entry models.LobbyEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return ErrLobbyNotFound
+	}
+	existing := meeting.FindLobbyEntry(entry.ID)
+	if existing == nil {
+		return ErrLobbyNotFound
+	}
+	if existing.Status != models.LobbyPending {
+		return ErrLobbyResolved
+	}
+	*existing = entry
+	meeting.UpdatedAt = time.Now()
+	s.notifyLocked(roomID)
+	return nil
+}
+
+func (s *MemoryMeetingStore) RemoveLobbyEntry(ctx context.Context, roomID string, requestID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return ErrLobbyNotFound
+	}
+	for i, entry := range meeting.Lobby {
+		if entry.ID == requestID {
+			meeting.Lobby = append(meeting.Lobby[:i:i], meeting.Lobby[i+1:]...)
+			meeting.UpdatedAt = time.Now()
+			s.notifyLocked(roomID)
+			return nil
+		}
+	}
+	return ErrLobbyNotFound
+}
+
+func (s *MemoryMeetingStore) TouchLobbyEntry(ctx context.Context, roomID string, requestID string, polledAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return ErrLobbyNotFound
+	}
+	entry := meeting.FindLobbyEntry(requestID)
+	if entry == nil {
+		return ErrLobbyNotFound
+	}
+	entry.LastPolledAt = polledAt
+	return nil
+}
+
+func (s *MemoryMeetingStore) PruneLobby(ctx context.Context, roomID string, resolvedBefore, abandonedBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return ErrMeetingNotFound
+	}
+	lobby := meeting.Lobby[:0:0]
+	for _, entry := range meeting.Lobby {
+		if !entry.Stale(resolvedBefore, abandonedBefore) {
+			lobby = append(lobby, entry)
+		}
+	}
+	if len(lobby) == len(meeting.Lobby) {
+		return nil
+	}
+	meeting.Lobby = lobby
+	meeting.UpdatedAt = time.Now()
+	s.notifyLocked(roomID)
+	return nil
+}
+
+// WatchMeeting ignores resumeToken, the in-memory store keeps no change history
+func (s *MemoryMeetingStore) WatchMeeting(ctx context.Context, roomID string, resumeToken []byte) (<-chan MeetingChange, error) {
+	updates := make(chan MeetingChange, 16)
+
+	s.mu.Lock()
+	if s.watchers[roomID] == nil {
+		s.watchers[roomID] = make(map[chan MeetingChange]struct{})
+	}
+	s.watchers[roomID][updates] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		s.mu.Lock()
+		delete(s.watchers[roomID], updates)
+		if len(s.watchers[roomID]) == 0 {
+			delete(s.watchers, roomID)
+		}
+		close(updates)
+		s.mu.Unlock()
+	}()
+
+	return updates, nil
+}
+
+// notifyLocked must be called with s.mu held. Slow watchers miss updates
+// instead of blocking writers.
+func (s *MemoryMeetingStore) notifyLocked(roomID string) {
+	meeting, ok := s.meetings[roomID]
+	if !ok {
+		return
+	}
+	for updates := range s.watchers[roomID] {
+		select {
+		case updates <- MeetingChange{Meeting: cloneMeeting(meeting)}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"meeting-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newTestStore returns a store holding one meeting with the given sessions
+func newTestStore(t *testing.T, sessionIDs ...string) (*MemoryMeetingStore, string) {
+	t.Helper()
+
+	s := NewMemoryMeetingStore()
+	meeting := models.NewMeeting("Standup", "", primitive.NewObjectID(), "room")
+	for _, id := range sessionIDs {
+		meeting.Sessions = append(meeting.Sessions, models.Session{
+			UserID:    primitive.NewObjectID(),
+			Username:  "user-" + id,
+			SessionID: id,
+		})
+	}
+	if err := s.CreateMeeting(context.Background(), meeting); err != nil {
+		t.Fatalf("CreateMeeting: %v", err)
+	}
+	return s, meeting.RoomID
+}
+
+func sessionIDsOf(t *testing.T, s *MemoryMeetingStore, roomID string) []string {
+	t.Helper()
+
+	meeting, err := s.GetMeetingByRoom(context.Background(), roomID)
+	if err != nil {
+		t.Fatalf("GetMeetingByRoom: %v", err)
+	}
+	ids := []string{}
+	for _, session := range meeting.Sessions {
+		ids = append(ids, session.SessionID)
+	}
+	return ids
+}
+
+func TestMemoryAddSession(t *testing.T) {
+	tests := []struct {
+		name    string
+		roomID  string
+		wantErr error
+		want    []string
+	}{
+		{"existing meeting", "room", nil, []string{"a", "b"}},
+		{"unknown meeting", "missing", ErrMeetingNotFound, []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, roomID := newTestStore(t, "a")
+			err := s.AddSession(context.Background(), tt.roomID, models.Session{SessionID: "b"})
+			if err != tt.wantErr {
+				t.Fatalf("AddSession() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := sessionIDsOf(t, s, roomID); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("sessions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryRemoveSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		sessions  []string
+		roomID    string
+		remove    string
+		wantErr   error
+		wantLast  bool
+		wantAfter []string
+	}{
+		{"one of several", []string{"a", "b"}, "room", "a", nil, false, []string{"b"}},
+		{"last session", []string{"a"}, "room", "a", nil, true, []string{}},
+		{"unknown session", []string{"a"}, "room", "x", ErrSessionNotFound, false, []string{"a"}},
+		{"unknown meeting", []string{"a"}, "missing", "a", ErrSessionNotFound, false, []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, roomID := newTestStore(t, tt.sessions...)
+			removed, last, err := s.RemoveSession(context.Background(), tt.roomID, tt.remove)
+			if err != tt.wantErr {
+				t.Fatalf("RemoveSession() error = %v, want %v", err, tt.wantErr)
+			}
+			if last != tt.wantLast {
+				t.Errorf("RemoveSession() last = %v, want %v", last, tt.wantLast)
+			}
+			if err == nil && removed.SessionID != tt.remove {
+				t.Errorf("RemoveSession() removed %q, want %q", removed.SessionID, tt.remove)
+			}
+			if got := sessionIDsOf(t, s, roomID); fmt.Sprint(got) != fmt.Sprint(tt.wantAfter) {
+				t.Errorf("sessions = %v, want %v", got, tt.wantAfter)
+			}
+		})
+	}
+
+	t.Run("removed twice", func(t *testing.T) {
+		s, roomID := newTestStore(t, "a")
+		if _, _, err := s.RemoveSession(context.Background(), roomID, "a"); err != nil {
+			t.Fatalf("first RemoveSession: %v", err)
+		}
+		if _, last, err := s.RemoveSession(context.Background(), roomID, "a"); err != ErrSessionNotFound || last {
+			t.Errorf("second RemoveSession() = last %v, error %v, want only ErrSessionNotFound", last, err)
+		}
+	})
+}
+
+func pendingEntry(username string) models.LobbyEntry {
+	return models.LobbyEntry{
+		ID:       "request-" + username,
+		Username: username,
+		Status:   models.LobbyPending,
+	}
+}
+
+func TestMemoryAddLobbyEntry(t *testing.T) {
+	resolved := pendingEntry("carol")
+	resolved.Status = models.LobbyDenied
+
+	tests := []struct {
+		name       string
+		existing   []models.LobbyEntry
+		username   string
+		maxPending int
+		wantErr    error
+	}{
+		{"empty lobby", nil, "alice", 2, nil},
+		{"pending under the same name", []models.LobbyEntry{pendingEntry("alice")}, "alice", 2, ErrLobbyDuplicate},
+		{"resolved under the same name", []models.LobbyEntry{resolved}, "carol", 2, nil},
+		{"full", []models.LobbyEntry{pendingEntry("alice"), pendingEntry("bob")}, "dave", 2, ErrLobbyFull},
+		{"resolved entries do not count", []models.LobbyEntry{pendingEntry("alice"), resolved}, "dave", 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, roomID := newTestStore(t, "host")
+			for _, entry := range tt.existing {
+				if err := s.AddLobbyEntry(context.Background(), roomID, pendingEntry(entry.Username), 10); err != nil {
+					t.Fatalf("adding %s: %v", entry.Username, err)
+				}
+				if entry.Status != models.LobbyPending {
+					if err := s.UpdateLobbyEntry(context.Background(), roomID, entry); err != nil {
+						t.Fatalf("resolving %s: %v", entry.Username, err)
+					}
+				}
+			}
+
+			entry := pendingEntry(tt.username)
+			entry.ID = "new"
+			err := s.AddLobbyEntry(context.Background(), roomID, entry, tt.maxPending)
+			if err != tt.wantErr {
+				t.Errorf("AddLobbyEntry() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("unknown meeting", func(t *testing.T) {
+		s, _ := newTestStore(t)
+		if err := s.AddLobbyEntry(context.Background(), "missing", pendingEntry("alice"), 2); err != ErrMeetingNotFound {
+			t.Errorf("AddLobbyEntry() error = %v, want %v", err, ErrMeetingNotFound)
+		}
+	})
+}
+
+func TestMemoryUpdateLobbyEntry(t *testing.T) {
+	tests := []struct {
+		name      string
+		resolved  bool
+		requestID string
+		wantErr   error
+	}{
+		{"pending entry", false, "request-alice", nil},
+		{"already resolved", true, "request-alice", ErrLobbyResolved},
+		{"unknown entry", false, "request-bob", ErrLobbyNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, roomID := newTestStore(t, "host")
+			if err := s.AddLobbyEntry(context.Background(), roomID, pendingEntry("alice"), 10); err != nil {
+				t.Fatalf("AddLobbyEntry: %v", err)
+			}
+			if tt.resolved {
+				entry := pendingEntry("alice")
+				entry.Status = models.LobbyDenied
+				if err := s.UpdateLobbyEntry(context.Background(), roomID, entry); err != nil {
+					t.Fatalf("resolving entry: %v", err)
+				}
+			}
+
+			update := pendingEntry("alice")
+			update.ID = tt.requestID
+			update.Status = models.LobbyAdmitted
+			update.SessionID = "admitted"
+			err := s.UpdateLobbyEntry(context.Background(), roomID, update)
+			if err != tt.wantErr {
+				t.Fatalf("UpdateLobbyEntry() error = %v, want %v", err, tt.wantErr)
+			}
+
+			meeting, _ := s.GetMeetingByRoom(context.Background(), roomID)
+			entry := meeting.FindLobbyEntry("request-alice")
+			if admitted := entry.Status == models.LobbyAdmitted; admitted != (err == nil) {
+				t.Errorf("entry status %q after UpdateLobbyEntry() error %v", entry.Status, err)
+			}
+		})
+	}
+}
+
+func TestMemoryEndMeeting(t *testing.T) {
+	s, roomID := newTestStore(t, "a", "b")
+	if err := s.AddLobbyEntry(context.Background(), roomID, pendingEntry("carol"), 10); err != nil {
+		t.Fatalf("AddLobbyEntry: %v", err)
+	}
+
+	endedAt := time.Now()
+	before, err := s.EndMeeting(context.Background(), roomID, endedAt)
+	if err != nil {
+		t.Fatalf("EndMeeting: %v", err)
+	}
+	if len(before.Sessions) != 2 || before.EndedAt != nil {
+		t.Errorf("EndMeeting() returned %d sessions, ended %v, want the meeting as it was", len(before.Sessions), before.EndedAt)
+	}
+
+	meeting, _ := s.GetMeetingByRoom(context.Background(), roomID)
+	if len(meeting.Sessions) != 0 || len(meeting.Lobby) != 0 {
+		t.Errorf("after EndMeeting %d sessions and %d lobby entries remain", len(meeting.Sessions), len(meeting.Lobby))
+	}
+	if meeting.EndedAt == nil || !meeting.EndedAt.Equal(endedAt) {
+		t.Errorf("EndedAt = %v, want %v", meeting.EndedAt, endedAt)
+	}
+
+	if _, err := s.EndMeeting(context.Background(), "missing", endedAt); err != ErrMeetingNotFound {
+		t.Errorf("EndMeeting() of unknown meeting error = %v, want %v", err, ErrMeetingNotFound)
+	}
+}
+
+func TestMemoryListIdleMeetings(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		sessions  int
+		updatedAt time.Time
+		wantIdle  bool
+	}{
+		{"empty and old", 0, now.Add(-time.Hour), true},
+		{"empty and recent", 0, now, false},
+		{"active and old", 1, now.Add(-time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryMeetingStore()
+			meeting := models.NewMeeting("Standup", "", primitive.NewObjectID(), "room")
+			for i := 0; i < tt.sessions; i++ {
+				meeting.Sessions = append(meeting.Sessions, models.Session{SessionID: fmt.Sprint(i)})
+			}
+			meeting.UpdatedAt = tt.updatedAt
+			if err := s.CreateMeeting(context.Background(), meeting); err != nil {
+				t.Fatalf("CreateMeeting: %v", err)
+			}
+
+			idle, err := s.ListIdleMeetings(context.Background(), now.Add(-time.Minute))
+			if err != nil {
+				t.Fatalf("ListIdleMeetings: %v", err)
+			}
+			if gotIdle := len(idle) == 1; gotIdle != tt.wantIdle {
+				t.Errorf("ListIdleMeetings() returned %d meetings, want idle %v", len(idle), tt.wantIdle)
+			}
+		})
+	}
+}
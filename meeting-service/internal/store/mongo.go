@@ -0,0 +1,462 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"meeting-service/internal/database"
+	"meeting-service/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoMeetingStore struct{}
+
+// NewMongoMeetingStore indexes room_id, every token-authenticated request
+// looks its meeting up by it. The other indexes serve the calendar feed and
+// the reaper, which would otherwise scan every meeting.
+func NewMongoMeetingStore(ctx context.Context) (*MongoMeetingStore, error) {
+	s := &MongoMeetingStore{}
+	err := createIndexes(ctx, s.meetings(),
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "room_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		mongo.IndexModel{Keys: bson.D{{Key: "creator_id", Value: 1}, {Key: "created_at", Value: 1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "sessions.session_id", Value: 1}}},
+		mongo.IndexModel{Keys: bson.D{{Key: "updated_at", Value: 1}}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// createIndexes makes sure the collection has the indexes its queries rely
+// on, indexes that already exist are left alone
+func createIndexes(ctx context.Context, collection *mongo.Collection, indexes ...mongo.IndexModel) error {
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+func (s *MongoMeetingStore) meetings() *mongo.Collection {
+	return database.GetCollection("meetings")
+}
+
+func (s *MongoMeetingStore) CreateMeeting(ctx context.Context, meeting *models.Meeting) error {
+	_, err := s.meetings().InsertOne(ctx, meeting)
+	return err
+}
+
+func (s *MongoMeetingStore) GetMeetingByRoom(ctx context.Context, roomID string) (*models.Meeting, error) {
+	var meeting models.Meeting
+	err := s.meetings().FindOne(ctx, bson.M{"room_id": roomID}).Decode(&meeting)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrMeetingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &meeting, nil
+}
+
+func (s *MongoMeetingStore) ListMeetingsByCreator(ctx context.Context, creatorID primitive.ObjectID) ([]models.Meeting, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := s.meetings().Find(ctx, bson.M{"creator_id": creatorID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	meetings := []models.Meeting{}
+	if err := cursor.All(ctx, &meetings); err != nil {
+		return nil, err
+	}
+	return meetings, nil
+}
+
+func (s *MongoMeetingStore) UpdateMeeting(ctx context.Context, meeting *models.Meeting) error {
+	meeting.UpdatedAt = time.Now()
+	result, err := s.meetings().ReplaceOne(ctx, bson.M{"room_id": meeting.RoomID}, meeting)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrMeetingNotFound
+	}
+	return nil
+}
+
+func (s *MongoMeetingStore) AddSession(ctx context.Context, roomID string, session models.Session) error {
+	result, err := s.meetings().UpdateOne(
+		ctx,
+		bson.M{"room_id": roomID},
+		bson.M{
+			"$push": bson.M{"sessions": session},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrMeetingNotFound
+	}
+	return nil
+}
+
+func (s *MongoMeetingStore) RemoveSession(ctx context.Context, roomID string, sessionID string) (*models.Session, bool, error) {
+	// Return the document as it was before the pull to know who left, and
+	// whether they were the last one
+	var before models.Meeting
+	err := s.meetings().FindOneAndUpdate(
+		ctx,
+		bson.M{"room_id": roomID, "sessions.session_id": sessionID},
+		bson.M{
+			"$pull": bson.M{"sessions": bson.M{"session_id": sessionID}},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return nil, false, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, session := range before.Sessions {
+		if session.SessionID == sessionID {
+			return &session, len(before.Sessions) == 1, nil
+		}
+	}
+	return nil, false, ErrSessionNotFound
+}
+
+func (s *MongoMeetingStore) TouchSessions(ctx context.Context, roomID string, sessionIDs []string, seenAt time.Time) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+	_, err := s.meetings().UpdateOne(
+		ctx,
+		bson.M{"room_id": roomID},
+		bson.M{"$set": bson.M{"sessions.$[session].last_seen_at": seenAt}},
+		options.Update().SetArrayFilters(options.ArrayFilters{
+			Filters: []interface{}{bson.M{"session.session_id": bson.M{"$in": sessionIDs}}},
+		}),
+	)
+	return err
+}
+
+func (s *MongoMeetingStore) AddAudioMids(ctx context.Context, roomID string, sessionID string, mids []string) error {
+	result, err := s.meetings().UpdateOne(
+		ctx,
+		bson.M{"room_id": roomID, "sessions.session_id": sessionID},
+		bson.M{"$addToSet": bson.M{"sessions.$.audio_mids": bson.M{"$each": mids}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *MongoMeetingStore) EndMeeting(ctx context.Context, roomID string, endedAt time.Time) (*models.Meeting, error) {
+	var before models.Meeting
+	err := s.meetings().FindOneAndUpdate(
+		ctx,
+		bson.M{"room_id": roomID},
+		bson.M{"$set": bson.M{
+			"ended_at":   endedAt,
+			"sessions":   []models.Session{},
+			"lobby":      []models.LobbyEntry{},
+			"updated_at": endedAt,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrMeetingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &before, nil
+}
+
+// ListActiveMeetings matches on session IDs rather than the array length so
+// the query is answered from the sessions.session_id index
+func (s *MongoMeetingStore) ListActiveMeetings(ctx context.Context) ([]models.Meeting, error) {
+	return s.find(ctx, bson.M{"sessions.session_id": bson.M{"$gt": ""}})
+}
+
+// ListIdleMeetings narrows down by the updated_at index, only the meetings
+// that went quiet are checked for sessions
+func (s *MongoMeetingStore) ListIdleMeetings(ctx context.Context, before time.Time) ([]models.Meeting, error) {
+	return s.find(ctx, bson.M{
+		"sessions.0": bson.M{"$exists": false},
+		"updated_at": bson.M{"$lt": before},
+	})
+}
+
+func (s *MongoMeetingStore) find(ctx context.Context, filter bson.M) ([]models.Meeting, error) {
+	cursor, err := s.meetings().Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	meetings := []models.Meeting{}
+	if err := cursor.All(ctx, &meetings); err != nil {
+		return nil, err
+	}
+	return meetings, nil
+}
+
+// ArchiveMeeting copies the document to meetings_archive before deleting it,
+// a crash in between leaves a copy in both rather than losing it. Meetings
+// that got a session in the meantime stay live.
+func (s *MongoMeetingStore) ArchiveMeeting(ctx context.Context, roomID string) error {
+	meeting, err := s.GetMeetingByRoom(ctx, roomID)
+	if err != nil {
+		return err
+	}
+
+	archive := database.GetCollection("meetings_archive")
+	_, err = archive.ReplaceOne(ctx, bson.M{"_id": meeting.ID}, meeting, options.Replace().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+
+	result, err := s.meetings().DeleteOne(ctx, bson.M{
+		"_id":        meeting.ID,
+		"sessions.0": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		_, err = archive.DeleteOne(ctx, bson.M{"_id": meeting.ID})
+		return err
+	}
+	return nil
+}
+
+func (s *MongoMeetingStore) AddCoHost(ctx context.Context, roomID string, userID primitive.ObjectID) error {
+	return s.addToSet(ctx, roomID, "co_host_ids", userID)
+}
+
+func (s *MongoMeetingStore) BanUsername(ctx context.Context, roomID string, username string) error {
+	return s.addToSet(ctx, roomID, "banned_usernames", username)
+}
+
+func (s *MongoMeetingStore) RevokeParticipant(ctx context.Context, roomID string, userID primitive.ObjectID) error {
+	return s.addToSet(ctx, roomID, "revoked_participant_ids", userID)
+}
+
+func (s *MongoMeetingStore) SetLocked(ctx context.Context, roomID string, locked bool) error {
+	result, err := s.meetings().UpdateOne(
+		ctx,
+		bson.M{"room_id": roomID},
+		bson.M{"$set": bson.M{"locked": locked, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrMeetingNotFound
+	}
+	return nil
+}
+
+func (s *MongoMeetingStore) AddLobbyEntry(ctx context.Context, roomID string, entry models.LobbyEntry, maxPending int) error {
+	result, err := s.meetings().UpdateOne(
+		ctx,
+		bson.M{
+			"room_id": roomID,
+			"lobby": bson.M{"$not": bson.M{"$elemMatch": bson.M{
+				"username": entry.Username,
+				"status":   models.LobbyPending,
+			}}},
+			"$expr": bson.M{"$lt": bson.A{
+				bson.M{"$size": bson.M{"$filter": bson.M{
+					"input": bson.M{"$ifNull": bson.A{"$lobby", bson.A{}}},
+					"cond":  bson.M{"$eq": bson.A{"$$this.status", models.LobbyPending}},
+				}}},
+				maxPending,
+			}},
+		},
+		bson.M{
+			"$push": bson.M{"lobby": entry},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		// Tell the caller which condition failed
+		meeting, err := s.GetMeetingByRoom(ctx, roomID)
+		if err != nil {
+			return err
+		}
+		if err := lobbyRefusal(meeting, entry.Username, maxPending); err != nil {
+			return err
+		}
+		// The lobby changed in between, the entry can be requested again
+		return ErrLobbyFull
+	}
+	return nil
+}
+
+func (s *MongoMeetingStore) UpdateLobbyEntry(ctx context.Context, roomID string, entry models.LobbyEntry) error {
+	// Only a pending entry is updated, two hosts resolving it at the same
+	// time cannot both succeed
+	result, err := s.meetings().UpdateOne(
+		ctx,
+		bson.M{
+			"room_id": roomID,
+			"lobby":   bson.M{"$elemMatch": bson.M{"id": entry.ID, "status": models.LobbyPending}},
+		},
+		bson.M{"$set": bson.M{"lobby.$": entry, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		meeting, err := s.GetMeetingByRoom(ctx, roomID)
+		if err != nil || meeting.FindLobbyEntry(entry.ID) == nil {
+			return ErrLobbyNotFound
+		}
+		return ErrLobbyResolved
+	}
+	return nil
+}
+
+func (s *MongoMeetingStore) RemoveLobbyEntry(ctx context.Context, roomID string, requestID string) error {
+	result, err := s.meetings().UpdateOne(
+		ctx,
+		bson.M{"room_id": roomID, "lobby.id": requestID},
+		bson.M{
+			"$pull": bson.M{"lobby": bson.M{"id": requestID}},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrLobbyNotFound
+	}
+	return nil
+}
+
+func (s *MongoMeetingStore) TouchLobbyEntry(ctx context.Context, roomID string, requestID string, polledAt time.Time) error {
+	result, err := s.meetings().UpdateOne(
+		ctx,
+		bson.M{"room_id": roomID, "lobby.id": requestID},
+		bson.M{"$set": bson.M{"lobby.$.last_polled_at": polledAt}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrLobbyNotFound
+	}
+	return nil
+}
+
+func (s *MongoMeetingStore) PruneLobby(ctx context.Context, roomID string, resolvedBefore, abandonedBefore time.Time) error {
+	stale := bson.M{"$or": bson.A{
+		bson.M{"status": models.LobbyPending, "last_polled_at": bson.M{"$lt": abandonedBefore}},
+		bson.M{"status": bson.M{"$ne": models.LobbyPending}, "resolved_at": bson.M{"$lt": resolvedBefore}},
+	}}
+	_, err := s.meetings().UpdateOne(
+		ctx,
+		bson.M{"room_id": roomID, "lobby": bson.M{"$elemMatch": stale}},
+		bson.M{
+			"$pull": bson.M{"lobby": stale},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	return err
+}
+
+func (s *MongoMeetingStore) addToSet(ctx context.Context, roomID string, field string, value interface{}) error {
+	result, err := s.meetings().UpdateOne(
+		ctx,
+		bson.M{"room_id": roomID},
+		bson.M{
+			"$addToSet": bson.M{field: value},
+			"$set":      bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrMeetingNotFound
+	}
+	return nil
+}
+
+func (s *MongoMeetingStore) WatchMeeting(ctx context.Context, roomID string, resumeToken []byte) (<-chan MeetingChange, error) {
+	pipeline := []bson.M{
+		{
+			"$match": bson.M{
+				"$and": []bson.M{
+					{"operationType": bson.M{"$in": []string{"update", "replace"}}},
+					{"fullDocument.room_id": roomID},
+					// TouchSessions leaves updated_at alone, presence is no change
+					{"$or": []bson.M{
+						{"operationType": "replace"},
+						{"updateDescription.updatedFields.updated_at": bson.M{"$exists": true}},
+					}},
+				},
+			},
+		},
+	}
+
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeToken != nil {
+		opts.SetResumeAfter(bson.Raw(resumeToken))
+	}
+
+	changeStream, err := s.meetings().Watch(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(chan MeetingChange)
+	go func() {
+		defer close(updates)
+		defer changeStream.Close(context.Background())
+
+		for changeStream.Next(ctx) {
+			var changeDoc struct {
+				FullDocument models.Meeting `bson:"fullDocument"`
+			}
+			if err := changeStream.Decode(&changeDoc); err != nil {
+				slog.Error("Error decoding change stream document", "room_id", roomID, "error", err)
+				continue
+			}
+
+			change := MeetingChange{
+				Meeting:     &changeDoc.FullDocument,
+				ResumeToken: append([]byte(nil), changeStream.ResumeToken()...),
+			}
+			select {
+			case updates <- change:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := changeStream.Err(); err != nil && ctx.Err() == nil {
+			slog.Warn("Change stream stopped", "room_id", roomID, "error", err)
+		}
+	}()
+
+	return updates, nil
+}
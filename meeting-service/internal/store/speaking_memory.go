@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"meeting-service/internal/models"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemorySpeakingStore keeps speaking summaries per room
+type MemorySpeakingStore struct {
+	mu        sync.RWMutex
+	summaries map[string][]models.SpeakingSummary
+}
+
+func NewMemorySpeakingStore() *MemorySpeakingStore {
+	return &MemorySpeakingStore{
+		summaries: make(map[string][]models.SpeakingSummary),
+	}
+}
+
+func (s *MemorySpeakingStore) SaveSpeakingSummary(ctx context.Context, summary *models.SpeakingSummary) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if summary.ID.IsZero() {
+		summary.ID = primitive.NewObjectID()
+	}
+	s.summaries[summary.RoomID] = append(s.summaries[summary.RoomID], *summary)
+	return nil
+}
+
+func (s *MemorySpeakingStore) ListSpeakingSummaries(ctx context.Context, roomID string) ([]models.SpeakingSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored := s.summaries[roomID]
+	summaries := make([]models.SpeakingSummary, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		summaries = append(summaries, stored[i])
+	}
+	return summaries, nil
+}
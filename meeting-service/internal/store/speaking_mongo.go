@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"meeting-service/internal/database"
+	"meeting-service/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoSpeakingStore struct{}
+
+// NewMongoSpeakingStore indexes the summaries in the order
+// ListSpeakingSummaries reads them
+func NewMongoSpeakingStore(ctx context.Context) (*MongoSpeakingStore, error) {
+	s := &MongoSpeakingStore{}
+	err := createIndexes(ctx, s.summaries(), mongo.IndexModel{
+		Keys: bson.D{{Key: "room_id", Value: 1}, {Key: "ended_at", Value: -1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *MongoSpeakingStore) summaries() *mongo.Collection {
+	return database.GetCollection("speaking_summaries")
+}
+
+func (s *MongoSpeakingStore) SaveSpeakingSummary(ctx context.Context, summary *models.SpeakingSummary) error {
+	_, err := s.summaries().InsertOne(ctx, summary)
+	return err
+}
+
+func (s *MongoSpeakingStore) ListSpeakingSummaries(ctx context.Context, roomID string) ([]models.SpeakingSummary, error) {
+	cursor, err := s.summaries().Find(
+		ctx,
+		bson.M{"room_id": roomID},
+		options.Find().SetSort(bson.M{"ended_at": -1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := []models.SpeakingSummary{}
+	if err := cursor.All(ctx, &summaries); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"meeting-service/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrMeetingNotFound = errors.New("meeting not found")
+	ErrSessionNotFound = errors.New("session not found")
+	ErrLobbyNotFound   = errors.New("lobby request not found")
+	ErrLobbyResolved   = errors.New("lobby request was already handled")
+	ErrLobbyFull       = errors.New("too many requests are waiting in the lobby")
+	ErrLobbyDuplicate  = errors.New("a request under this name is already waiting in the lobby")
+	ErrWebhookNotFound = errors.New("webhook not found")
+	ErrChatNotFound    = errors.New("chat message not found")
+	// ErrChatConflict is returned when a message kept changing during an update
+	ErrChatConflict = errors.New("chat message was changed concurrently, try again")
+)
+
+// MeetingStore hides the storage backend used for meetings so handlers can run
+// against MongoDB in production and an in-memory store for local dev and tests
+type MeetingStore interface {
+	CreateMeeting(ctx context.Context, meeting *models.Meeting) error
+	GetMeetingByRoom(ctx context.Context, roomID string) (*models.Meeting, error)
+	// ListMeetingsByCreator returns the meetings a user created, oldest first
+	ListMeetingsByCreator(ctx context.Context, creatorID primitive.ObjectID) ([]models.Meeting, error)
+	UpdateMeeting(ctx context.Context, meeting *models.Meeting) error
+	AddSession(ctx context.Context, roomID string, session models.Session) error
+	// RemoveSession returns the removed session so callers can still report who
+	// left, last is true for whoever removed the meeting's last session
+	RemoveSession(ctx context.Context, roomID string, sessionID string) (removed *models.Session, last bool, err error)
+	// TouchSessions records that the sessions still have a live WebSocket, it
+	// does not count as an update of the meeting
+	TouchSessions(ctx context.Context, roomID string, sessionIDs []string, seenAt time.Time) error
+	// AddAudioMids records audio tracks the session published, a mute closes them
+	AddAudioMids(ctx context.Context, roomID string, sessionID string, mids []string) error
+	AddCoHost(ctx context.Context, roomID string, userID primitive.ObjectID) error
+	BanUsername(ctx context.Context, roomID string, username string) error
+	// RevokeParticipant invalidates the join tokens of the participant
+	RevokeParticipant(ctx context.Context, roomID string, userID primitive.ObjectID) error
+	SetLocked(ctx context.Context, roomID string, locked bool) error
+	// AddLobbyEntry refuses the entry while maxPending entries are pending or
+	// one under the same username is
+	AddLobbyEntry(ctx context.Context, roomID string, entry models.LobbyEntry, maxPending int) error
+	// UpdateLobbyEntry only replaces an entry that is still pending, otherwise
+	// it returns ErrLobbyResolved
+	UpdateLobbyEntry(ctx context.Context, roomID string, entry models.LobbyEntry) error
+	RemoveLobbyEntry(ctx context.Context, roomID string, requestID string) error
+	// TouchLobbyEntry records that the requester is still polling
+	TouchLobbyEntry(ctx context.Context, roomID string, requestID string, polledAt time.Time) error
+	// PruneLobby drops the entries resolved before resolvedBefore whose
+	// outcome the requester never collected, and the pending ones whose
+	// requester stopped polling before abandonedBefore
+	PruneLobby(ctx context.Context, roomID string, resolvedBefore, abandonedBefore time.Time) error
+	// EndMeeting marks the meeting ended and clears its sessions and lobby. It
+	// returns the meeting as it was before so callers can clean up the sessions.
+	EndMeeting(ctx context.Context, roomID string, endedAt time.Time) (*models.Meeting, error)
+	// ListActiveMeetings returns the meetings that still have sessions
+	ListActiveMeetings(ctx context.Context) ([]models.Meeting, error)
+	// ListIdleMeetings returns meetings without sessions not updated since before
+	ListIdleMeetings(ctx context.Context, before time.Time) ([]models.Meeting, error)
+	// ArchiveMeeting moves the meeting out of the live collection
+	ArchiveMeeting(ctx context.Context, roomID string) error
+	// WatchMeeting emits the full meeting document after every update until ctx
+	// is done. A non-nil resumeToken continues right after that change.
+	WatchMeeting(ctx context.Context, roomID string, resumeToken []byte) (<-chan MeetingChange, error)
+}
+
+// MeetingChange is one update seen by WatchMeeting. ResumeToken is opaque and
+// may be nil for backends that cannot resume.
+type MeetingChange struct {
+	Meeting     *models.Meeting
+	ResumeToken []byte
+}
+
+// ChatStore persists chat messages per room
+type ChatStore interface {
+	SaveChatMessage(ctx context.Context, message *models.ChatMessage) error
+	// ListChatMessages returns up to limit messages the viewer may see older
+	// than before (all messages when before is zero), oldest first
+	ListChatMessages(ctx context.Context, roomID string, viewer, before primitive.ObjectID, limit int) ([]models.ChatMessage, error)
+	GetChatMessage(ctx context.Context, roomID string, id primitive.ObjectID) (*models.ChatMessage, error)
+	// UpdateChatMessage applies update to the message and saves it, update
+	// runs again when the message changed in the meantime. An error from
+	// update aborts and is returned as is.
+	UpdateChatMessage(ctx context.Context, roomID string, id primitive.ObjectID, update func(message *models.ChatMessage) error) (*models.ChatMessage, error)
+}
+
+// WebhookStore keeps registered webhooks and the persistent delivery queue
+type WebhookStore interface {
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	ListWebhooks(ctx context.Context, roomID string) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, roomID string, id primitive.ObjectID) error
+	EnqueueDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	// ClaimDelivery returns a pending delivery that is due at now and hides it
+	// from other claimers for lease. It returns nil when nothing is due.
+	ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*models.WebhookDelivery, error)
+	// UpdateDelivery stores a pending delivery's next attempt and removes one
+	// that was delivered or failed for good
+	UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+}
+
+// AttendanceStore records attendance events per room
+type AttendanceStore interface {
+	RecordAttendance(ctx context.Context, event *models.AttendanceEvent) error
+	// ListAttendance returns the room's events in the order they happened
+	ListAttendance(ctx context.Context, roomID string) ([]models.AttendanceEvent, error)
+}
+
+// SpeakingStore keeps the speaking summaries of finished meetings
+type SpeakingStore interface {
+	SaveSpeakingSummary(ctx context.Context, summary *models.SpeakingSummary) error
+	// ListSpeakingSummaries returns the room's summaries, most recent first
+	ListSpeakingSummaries(ctx context.Context, roomID string) ([]models.SpeakingSummary, error)
+}
+
+// lobbyRefusal returns why the meeting's lobby takes no new entry for the
+// username, nil when it does
+func lobbyRefusal(meeting *models.Meeting, username string, maxPending int) error {
+	pending := 0
+	for _, entry := range meeting.Lobby {
+		if entry.Status != models.LobbyPending {
+			continue
+		}
+		if entry.Username == username {
+			return ErrLobbyDuplicate
+		}
+		pending++
+	}
+	if pending >= maxPending {
+		return ErrLobbyFull
+	}
+	return nil
+}
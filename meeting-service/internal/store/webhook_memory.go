@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"meeting-service/internal/models"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryWebhookStore keeps webhooks and their delivery queue in process
+// memory, queued deliveries are lost on restart
+type MemoryWebhookStore struct {
+	mu         sync.Mutex
+	webhooks   []models.Webhook
+	deliveries []*models.WebhookDelivery
+}
+
+func NewMemoryWebhookStore() *MemoryWebhookStore {
+	return &MemoryWebhookStore{}
+}
+
+func (s *MemoryWebhookStore) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if webhook.ID.IsZero() {
+		webhook.ID = primitive.NewObjectID()
+	}
+	clone := *webhook
+	clone.Events = append([]string{}, webhook.Events...)
+	s.webhooks = append(s.webhooks, clone)
+	return nil
+}
+
+func (s *MemoryWebhookStore) ListWebhooks(ctx context.Context, roomID string) ([]models.Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhooks := []models.Webhook{}
+	for _, webhook := range s.webhooks {
+		if webhook.RoomID == roomID {
+			webhook.Events = append([]string{}, webhook.Events...)
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (s *MemoryWebhookStore) DeleteWebhook(ctx context.Context, roomID string, id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, webhook := range s.webhooks {
+		if webhook.ID == id && webhook.RoomID == roomID {
+			s.webhooks = append(s.webhooks[:i], s.webhooks[i+1:]...)
+			return nil
+		}
+	}
+	return ErrWebhookNotFound
+}
+
+func (s *MemoryWebhookStore) EnqueueDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if delivery.ID.IsZero() {
+		delivery.ID = primitive.NewObjectID()
+	}
+	clone := *delivery
+	s.deliveries = append(s.deliveries, &clone)
+	return nil
+}
+
+func (s *MemoryWebhookStore) ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due *models.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.Status != models.DeliveryPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		if due == nil || delivery.NextAttemptAt.Before(due.NextAttemptAt) {
+			due = delivery
+		}
+	}
+	if due == nil {
+		return nil, nil
+	}
+
+	due.NextAttemptAt = now.Add(lease)
+	clone := *due
+	return &clone, nil
+}
+
+func (s *MemoryWebhookStore) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.deliveries {
+		if existing.ID == delivery.ID {
+			// Finished deliveries are dropped, nothing reads them back
+			if delivery.Status != models.DeliveryPending {
+				s.deliveries = append(s.deliveries[:i], s.deliveries[i+1:]...)
+				return nil
+			}
+			clone := *delivery
+			s.deliveries[i] = &clone
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"meeting-service/internal/database"
+	"meeting-service/internal/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoWebhookStore struct{}
+
+// NewMongoWebhookStore indexes the deliveries for ClaimDelivery, every worker
+// of every instance polls it, and the webhooks by the room they belong to
+func NewMongoWebhookStore(ctx context.Context) (*MongoWebhookStore, error) {
+	s := &MongoWebhookStore{}
+	err := createIndexes(ctx, s.deliveries(), mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = createIndexes(ctx, s.webhooks(), mongo.IndexModel{
+		Keys: bson.D{{Key: "room_id", Value: 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *MongoWebhookStore) webhooks() *mongo.Collection {
+	return database.GetCollection("webhooks")
+}
+
+func (s *MongoWebhookStore) deliveries() *mongo.Collection {
+	return database.GetCollection("webhook_deliveries")
+}
+
+func (s *MongoWebhookStore) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	if webhook.ID.IsZero() {
+		webhook.ID = primitive.NewObjectID()
+	}
+	_, err := s.webhooks().InsertOne(ctx, webhook)
+	return err
+}
+
+func (s *MongoWebhookStore) ListWebhooks(ctx context.Context, roomID string) ([]models.Webhook, error) {
+	cursor, err := s.webhooks().Find(ctx, bson.M{"room_id": roomID})
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := []models.Webhook{}
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (s *MongoWebhookStore) DeleteWebhook(ctx context.Context, roomID string, id primitive.ObjectID) error {
+	result, err := s.webhooks().DeleteOne(ctx, bson.M{"_id": id, "room_id": roomID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (s *MongoWebhookStore) EnqueueDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if delivery.ID.IsZero() {
+		delivery.ID = primitive.NewObjectID()
+	}
+	_, err := s.deliveries().InsertOne(ctx, delivery)
+	return err
+}
+
+func (s *MongoWebhookStore) ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*models.WebhookDelivery, error) {
+	// Pushing next_attempt_at past the lease keeps other instances away from it
+	var delivery models.WebhookDelivery
+	err := s.deliveries().FindOneAndUpdate(
+		ctx,
+		bson.M{"status": models.DeliveryPending, "next_attempt_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}},
+		options.FindOneAndUpdate().
+			SetSort(bson.M{"next_attempt_at": 1}).
+			SetReturnDocument(options.After),
+	).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (s *MongoWebhookStore) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	// Finished deliveries are dropped like in memory, they hold signed bodies
+	// and nothing reads them back
+	if delivery.Status != models.DeliveryPending {
+		_, err := s.deliveries().DeleteOne(ctx, bson.M{"_id": delivery.ID})
+		return err
+	}
+	_, err := s.deliveries().ReplaceOne(ctx, bson.M{"_id": delivery.ID}, delivery)
+	return err
+}